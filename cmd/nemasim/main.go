@@ -0,0 +1,231 @@
+// Command nemasim runs the neural simulation offline. It loads a state from
+// the database or from a JSON file, runs it for a number of steps under a
+// stimulus script and writes the time series of every neuron as CSV or JSONL.
+// It neither starts the server nor calls an LLM, and it never writes to the
+// database.
+//
+// Usage:
+//
+//	nemasim -db nema.db -steps 500 -script script.csv -out run.csv
+//	nemasim -state state.json -steps 500 -format jsonl
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/brainsonchain/nema/nema"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	// -------------------------------------------------------------------------
+	// FLAGS
+	var (
+		dbPath     = flag.String("db", "", "load the latest state from this database")
+		worm       = flag.String("worm", nema.DefaultWorm, "worm whose state is loaded from the database")
+		statePath  = flag.String("state", "", "load the state from this JSON file")
+		steps      = flag.Int("steps", 100, "number of simulation steps")
+		scriptPath = flag.String("script", "", "stimulus script (CSV or JSON)")
+		outPath    = flag.String("out", "", "output file, defaults to stdout")
+		format     = flag.String("format", "", "output format: csv or jsonl, defaults to the output file extension or csv")
+
+		// The data files default to the same env vars as the service
+		rosterPath     = flag.String("roster", os.Getenv("ROSTER_PATH"), "roster data file")
+		connectomePath = flag.String("connectome", os.Getenv("CONNECTOME_PATH"), "connectome data file")
+		paramsPath     = flag.String("params", os.Getenv("NEURON_PARAMS_PATH"), "neuron params data file")
+		model          = flag.String("model", os.Getenv("NEURON_MODEL"), "neuron model: leaky, threshold or graded")
+		noise          = flag.Float64("noise", 0, "standard deviation of the noise input per neuron and step")
+		seed           = flag.Uint64("seed", 0, "seed of the noise")
+	)
+	flag.Parse()
+
+	if *dbPath != "" && *statePath != "" {
+		return fmt.Errorf("-db and -state are mutually exclusive")
+	}
+	if *format == "" {
+		*format = "csv"
+		if filepath.Ext(*outPath) == ".jsonl" {
+			*format = "jsonl"
+		}
+	}
+
+	// -------------------------------------------------------------------------
+	// Simulation
+	roster, err := nema.LoadRoster(*rosterPath)
+	if err != nil {
+		return fmt.Errorf("error loading roster: %w", err)
+	}
+
+	connectome, err := nema.LoadConnectome(*connectomePath)
+	if err != nil {
+		return fmt.Errorf("error loading connectome: %w", err)
+	}
+
+	neuronParams, err := nema.LoadNeuronParams(*paramsPath)
+	if err != nil {
+		return fmt.Errorf("error loading neuron params: %w", err)
+	}
+
+	neuronModel, err := nema.NewNeuronModel(*model)
+	if err != nil {
+		return fmt.Errorf("error creating neuron model: %w", err)
+	}
+
+	// The learning rates follow the same env vars as the service
+	plasticity := nema.DefaultPlasticityConfig
+	for name, rate := range map[string]*float64{
+		"HEBBIAN_RATE":              &plasticity.HebbianRate,
+		"HABITUATION_RATE":          &plasticity.HabituationRate,
+		"HABITUATION_RECOVERY_RATE": &plasticity.RecoveryRate,
+	} {
+		if err := envFloat(name, rate); err != nil {
+			return err
+		}
+	}
+
+	sim := nema.NewSimulator(connectome, nema.SimConfig{
+		Model:      neuronModel,
+		Params:     neuronParams,
+		Plasticity: plasticity,
+		Noise:      *noise,
+		Seed:       *seed,
+	})
+
+	script, err := nema.LoadScript(*scriptPath)
+	if err != nil {
+		return fmt.Errorf("error loading script: %w", err)
+	}
+
+	// -------------------------------------------------------------------------
+	// State
+	state := nema.NewNeuro(roster, nema.SystemClock{})
+	switch {
+	case *dbPath != "":
+		db, err := nema.OpenDBReadOnly(*dbPath)
+		if err != nil {
+			return fmt.Errorf("error opening database: %w", err)
+		}
+		defer db.Close()
+		if state, err = db.Worm(*worm).LoadState(); err != nil {
+			return fmt.Errorf("error loading state: %w", err)
+		}
+	case *statePath != "":
+		data, err := os.ReadFile(*statePath)
+		if err != nil {
+			return fmt.Errorf("error reading state file: %w", err)
+		}
+		if state, err = nema.ReadState(data); err != nil {
+			return err
+		}
+	}
+	// A saved state follows the roster of this run
+	state = state.OnRoster(roster)
+
+	// -------------------------------------------------------------------------
+	// Output
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("error creating output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+
+	var record func(nema.Sample) error
+	switch *format {
+	case "csv":
+		record = csvRecorder(w)
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		record = func(s nema.Sample) error { return enc.Encode(s) }
+	default:
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+
+	start := time.Now()
+	if err := sim.RunScript(&state, *steps, script, record); err != nil {
+		return fmt.Errorf("error writing sample: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	log.Printf("ran %d steps in %s", *steps, time.Since(start))
+
+	return nil
+}
+
+// csvRecorder writes one row per sample with the behavior, the position,
+// modulators, lifecycle and sleep state of the worm and a column per neuron.
+// The neuron columns are taken from the first sample in alphabetical order.
+func csvRecorder(w io.Writer) func(nema.Sample) error {
+	cw := csv.NewWriter(w)
+	var neurons []string
+
+	return func(s nema.Sample) error {
+		if neurons == nil {
+			for name := range s.Neurons {
+				neurons = append(neurons, name)
+			}
+			slices.Sort(neurons)
+
+			header := []string{"step", "behavior", "confidence", "x", "y", "heading",
+				"serotonin", "dopamine", "octopamine", "tyramine",
+				"age_hours", "stage", "satiety", "energy", "asleep"}
+			if err := cw.Write(append(header, neurons...)); err != nil {
+				return err
+			}
+		}
+
+		f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+		row := []string{
+			strconv.Itoa(s.Step), s.Behavior.Label, f(s.Behavior.Confidence),
+			f(s.Environment.X), f(s.Environment.Y), f(s.Environment.Heading),
+			f(s.Modulators.Serotonin), f(s.Modulators.Dopamine),
+			f(s.Modulators.Octopamine), f(s.Modulators.Tyramine),
+			f(s.Lifecycle.AgeHours), s.Lifecycle.Stage, f(s.Lifecycle.Satiety), f(s.Lifecycle.Energy),
+			strconv.FormatBool(s.Sleep.Asleep),
+		}
+		for _, name := range neurons {
+			row = append(row, strconv.Itoa(s.Neurons[name]))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+// envFloat parses the env var with the given name into v. It leaves v
+// unchanged if the env var is not set.
+func envFloat(name string, v *float64) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*v = f
+	return nil
+}
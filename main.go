@@ -6,11 +6,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
-	"github.com/tmc/langchaingo/llms/openai"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
@@ -82,46 +82,197 @@ func run(ctx context.Context, l *zap.Logger) error {
 	}
 	initialPrompt := string(initialPromptBytes)
 
+	// -------------------------------------------------------------------------
+	// Simulation
+	l.Info("creating simulator")
+
+	// The ROSTER_PATH, REGISTRY_PATH, CONNECTOME_PATH and NEURON_PARAMS_PATH
+	// env vars point to local data files. The data bundled with the service is used for any
+	// that are not set.
+	roster, err := nema.LoadRoster(os.Getenv("ROSTER_PATH"))
+	if err != nil {
+		return fmt.Errorf("error loading roster: %w", err)
+	}
+
+	registry, err := nema.LoadRegistry(os.Getenv("REGISTRY_PATH"))
+	if err != nil {
+		return fmt.Errorf("error loading neuron registry: %w", err)
+	}
+
+	connectome, err := nema.LoadConnectome(os.Getenv("CONNECTOME_PATH"))
+	if err != nil {
+		return fmt.Errorf("error loading connectome: %w", err)
+	}
+
+	neuronParams, err := nema.LoadNeuronParams(os.Getenv("NEURON_PARAMS_PATH"))
+	if err != nil {
+		return fmt.Errorf("error loading neuron params: %w", err)
+	}
+
+	if err := nema.ValidateNetwork(roster, registry, connectome, neuronParams); err != nil {
+		return fmt.Errorf("error validating network data: %w", err)
+	}
+
+	// The NEURON_MODEL env var selects the neuron dynamics: leaky, threshold
+	// or graded. Defaults to threshold.
+	neuronModel, err := nema.NewNeuronModel(os.Getenv("NEURON_MODEL"))
+	if err != nil {
+		return fmt.Errorf("error creating neuron model: %w", err)
+	}
+	l.Info("using neuron model", zap.String("model", neuronModel.Name()))
+
+	// The HEBBIAN_RATE, HABITUATION_RATE and HABITUATION_RECOVERY_RATE env
+	// vars override the default learning rates.
+	plasticity := nema.DefaultPlasticityConfig
+	for name, rate := range map[string]*float64{
+		"HEBBIAN_RATE":              &plasticity.HebbianRate,
+		"HABITUATION_RATE":          &plasticity.HabituationRate,
+		"HABITUATION_RECOVERY_RATE": &plasticity.RecoveryRate,
+	} {
+		if err := envFloat(name, rate); err != nil {
+			return err
+		}
+	}
+
+	// DETERMINISTIC=true makes runs reproducible: the clock is simulated, the
+	// LLM is asked with a temperature of 0 and every source of randomness is
+	// seeded with SEED. Otherwise SEED is optional.
+	deterministic := os.Getenv("DETERMINISTIC") == "true"
+	seed := time.Now().UnixNano()
+	if s := os.Getenv("SEED"); s != "" {
+		seed, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid SEED: %w", err)
+		}
+	} else if deterministic {
+		return fmt.Errorf("SEED is required in deterministic mode")
+	}
+
+	var clock nema.Clock = nema.SystemClock{}
+	if deterministic {
+		l.Info("running in deterministic mode", zap.Int64("seed", seed))
+		clock = nema.NewSimClock(time.Unix(seed, 0), time.Second)
+	}
+
+	// NEURON_NOISE is the standard deviation of the random input each neuron
+	// receives per step. Defaults to no noise.
+	var noise float64
+	if err := envFloat("NEURON_NOISE", &noise); err != nil {
+		return err
+	}
+
+	sim := nema.NewSimulator(connectome, nema.SimConfig{
+		Model:      neuronModel,
+		Params:     neuronParams,
+		Plasticity: plasticity,
+		Noise:      noise,
+		Seed:       uint64(seed),
+	})
+
+	// DECAY_INTERVAL, MOTOR_HALF_LIFE, SENSORY_HALF_LIFE and DECAY_CHECKPOINT
+	// override the homeostatic decay settings, e.g. "30s" or "10m". An
+	// interval of 0 disables the decay, which is the default in deterministic
+	// mode as it runs on the wall clock.
+	decay := nema.DefaultDecayConfig
+	if deterministic {
+		decay.Interval = 0
+	}
+	for name, d := range map[string]*time.Duration{
+		"DECAY_INTERVAL":    &decay.Interval,
+		"MOTOR_HALF_LIFE":   &decay.MotorHalfLife,
+		"SENSORY_HALF_LIFE": &decay.SensoryHalfLife,
+		"DECAY_CHECKPOINT":  &decay.Checkpoint,
+	} {
+		if err := envDuration(name, d); err != nil {
+			return err
+		}
+	}
+
 	// -------------------------------------------------------------------------
 	// LLM
 	l.Info("creating llm")
 
-	// Check the MODEL_PROVIDER env var. If ollama is set, use the ollama client
-	// to create the LLM. Otherwise, use the openai client.
+	// LLM_PROVIDERS_PATH points to a JSON file with the named LLM backends and
+	// their fallback chain. Without it MODEL_PROVIDER selects a single
+	// ollama, openai or mock backend, defaulting to mock.
 	var llm llms.Model
-
-	switch os.Getenv("MODEL_PROVIDER") {
-	case "ollama":
-		l.Info("creating ollama client")
-		llm, err = ollama.New(ollama.WithModel(os.Getenv("OLLAMA_MODEL")))
-		if err != nil {
-			return fmt.Errorf("error creating ollama client: %w", err)
+	if path := os.Getenv("LLM_PROVIDERS_PATH"); path != "" {
+		llm, err = nema.LoadProviders(l, path, &mock.MockLLM{})
+	} else {
+		provider := os.Getenv("MODEL_PROVIDER")
+		if provider == "" {
+			provider = nema.ProviderMock
 		}
-	case "openai":
-		l.Info("creating openai client")
-		llm, err = openai.New()
-		if err != nil {
-			return fmt.Errorf("error creating LLM: %w", err)
+		// The openai client reads its model and key from the OPENAI_ env vars
+		p := nema.ProviderConfig{Name: provider, Type: provider}
+		if provider == nema.ProviderOllama {
+			p.Model = os.Getenv("OLLAMA_MODEL")
+		}
+		llm, err = nema.NewProviders(l, nema.ProvidersConfig{
+			Providers: []nema.ProviderConfig{p},
+			Fallback:  []string{provider},
+		}, &mock.MockLLM{})
+	}
+	if err != nil {
+		return fmt.Errorf("error creating LLM: %w", err)
+	}
+
+	// LLM_MODE selects how prompts change the neurons: direct lets the LLM
+	// write the neuron values, hybrid lets it only propose stimuli for the
+	// simulation. Defaults to direct.
+	mode := os.Getenv("LLM_MODE")
+
+	// LLM_MAX_REPAIRS is how many times an answer that does not match the
+	// schema is sent back to the LLM to be fixed. Defaults to 2, a negative
+	// value disables repairs.
+	var maxRepairs int
+	if err := envInt("LLM_MAX_REPAIRS", &maxRepairs); err != nil {
+		return err
+	}
+
+	// LLM_TOKEN_BUDGET is the most tokens the conversation may hold before
+	// older turns are compacted into a summary, 0 disables it. LLM_KEEP_TURNS
+	// is how many recent turns are always kept verbatim.
+	window := nema.DefaultWindowConfig
+	for name, v := range map[string]*int{
+		"LLM_TOKEN_BUDGET": &window.TokenBudget,
+		"LLM_KEEP_TURNS":   &window.KeepTurns,
+	} {
+		if err := envInt(name, v); err != nil {
+			return err
 		}
-	default:
-		l.Info("creating mock llm")
-		llm = &mock.MockLLM{}
 	}
 
 	// -------------------------------------------------------------------------
 	// Nema
-	l.Info("creating nema manager")
+	l.Info("creating worm managers")
 
-	nemaManager, err := nema.NewManager(l, db, initialPrompt, llm)
+	worms, err := nema.NewWorms(l, db, nema.Config{
+		InitialPrompt: initialPrompt,
+		LLM:           llm,
+		Roster:        roster,
+		Registry:      registry,
+		Simulator:     sim,
+		Clock:         clock,
+		Deterministic: deterministic,
+		Seed:          int(seed),
+		Decay:         decay,
+		Mode:          mode,
+		MaxRepairs:    maxRepairs,
+		Window:        window,
+	})
 	if err != nil {
-		return fmt.Errorf("error creating Nema Manager: %w", err)
+		return fmt.Errorf("error creating worm managers: %w", err)
 	}
 
+	// Let the worms calm down between interactions
+	go worms.RunDecay(ctx)
+
 	// -------------------------------------------------------------------------
 	// SERVER
 	l.Info("creating server")
 
-	srv := server.NewServer(l, nemaManager)
+	srv := server.NewServer(l, worms)
 
 	// -------------------------------------------------------------------------
 	// ERROR CHANNEL
@@ -145,3 +296,48 @@ func run(ctx context.Context, l *zap.Logger) error {
 
 	return nil
 }
+
+// envFloat parses the env var with the given name into v. It leaves v
+// unchanged if the env var is not set.
+func envFloat(name string, v *float64) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*v = f
+	return nil
+}
+
+// envInt parses the env var with the given name into v. It leaves v unchanged
+// if the env var is not set.
+func envInt(name string, v *int) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*v = i
+	return nil
+}
+
+// envDuration parses the env var with the given name into d. It leaves d
+// unchanged if the env var is not set.
+func envDuration(name string, d *time.Duration) error {
+	s := os.Getenv(name)
+	if s == "" {
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*d = v
+	return nil
+}
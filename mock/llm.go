@@ -2,8 +2,11 @@ package mock
 
 import (
 	"context"
+	"strings"
 
 	"github.com/tmc/langchaingo/llms"
+
+	"github.com/brainsonchain/nema/nema"
 )
 
 /*
@@ -31,18 +34,48 @@ func (m *MockLLM) GenerateContent(
 	messages []llms.MessageContent,
 	options ...llms.CallOption,
 ) (*llms.ContentResponse, error) {
-	responseStr := `
+	var prompt string
+	if len(messages) > 0 {
+		for _, part := range messages[len(messages)-1].Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				prompt += text.Text
+			}
+		}
+	}
+
+	// The mock recognises the prompts of the hybrid mode and of the
+	// conversation summary by how they start or end, and answers every other
+	// prompt like the direct mode
+	var responseStr string
+	switch {
+	case strings.HasPrefix(prompt, nema.InterpretPrefix):
+		responseStr = `{"stimuli": [{"type": "anterior_touch", "intensity": 0.5, "duration": 10}]}`
+	case strings.HasSuffix(prompt, nema.ReplySuffix):
+		responseStr = `{"human_message": "Hello, world!"}`
+	case strings.HasPrefix(prompt, nema.SummaryPrefix):
+		responseStr = "Someone said hello to Nema."
+	default:
+		responseStr = directResponse
+	}
+
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{
+		{Content: responseStr},
+	}}, nil
+}
+
+// directResponse is the answer to a prompt in direct mode.
+const directResponse = `
 		{
 			"human_message": "Hello, world!",
 			"motor_neurons": [
 				{
-					"neuron": "motor_neuron_1",
+					"neuron": "N_MDL01",
 					"value": 1
 				}
 			],
 			"sensory_neurons": [
 				{
-					"neuron": "sensory_neuron_1",
+					"neuron": "N_ASHL",
 					"value": 1
 				}
 			],
@@ -50,11 +83,6 @@ func (m *MockLLM) GenerateContent(
 		}
 	`
 
-	return &llms.ContentResponse{Choices: []*llms.ContentChoice{
-		{Content: responseStr},
-	}}, nil
-}
-
 func (m *MockLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
 	return "", nil
 }
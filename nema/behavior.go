@@ -0,0 +1,87 @@
+package nema
+
+import "math"
+
+// Behaviors reported by the classifier
+const (
+	behaviorForward  = "forward"
+	behaviorReversal = "reversal"
+	behaviorOmega    = "omega_turn"
+	behaviorPause    = "pause"
+	behaviorPumping  = "pumping"
+)
+
+// behavior is what the worm is doing, as read from its motor output.
+type behavior struct {
+	Label string `json:"label"`
+	// Confidence is the share of the winning behavior's score in the scores
+	// of all behaviors, between 0 and 1.
+	Confidence float64 `json:"confidence"`
+}
+
+// activity returns the mean depolarisation of the given neurons between 0 and
+// 1. Neurons missing from the state count as silent.
+func activity(n *neuro, neurons ...string) float64 {
+	var sum float64
+	for _, name := range neurons {
+		value, _ := n.value(name)
+		sum += depolarisation(float64(value))
+	}
+	return sum / float64(len(neurons))
+}
+
+// depolarisation returns how depolarised a neuron with the given value is,
+// between 0 and 1.
+func depolarisation(value float64) float64 {
+	return math.Max(value, 0) / 127
+}
+
+// classifyBehavior scores each behavior from the command interneurons, the
+// body wall muscles and the pharyngeal motor neurons and returns the best one.
+//
+//   - Forward crawling is driven by AVB and PVC and reversals by AVA and AVD.
+//   - An omega turn is a reversal followed by a deep ventral bend of the whole
+//     body.
+//   - Pumping is driven by the pharyngeal motor neurons MC, M3 and M4.
+//   - The worm pauses when neither the command interneurons nor the body wall
+//     muscles are active.
+func classifyBehavior(n *neuro) behavior {
+	forward := activity(n, "N_AVBL", "N_AVBR", "N_PVCL", "N_PVCR")
+	backward := activity(n, "N_AVAL", "N_AVAR", "N_AVDL", "N_AVDR")
+	pumping := activity(n, "N_MCL", "N_MCR", "N_M3L", "N_M3R", "N_M4")
+
+	var muscles, ventralBend float64
+	for _, s := range computePosture(n).Segments {
+		muscles += math.Max(s.Dorsal, s.Ventral)
+		ventralBend += s.Ventral - s.Dorsal
+	}
+	muscles /= bodySegments
+	ventralBend = math.Max(ventralBend/bodySegments, 0)
+
+	scores := []struct {
+		label string
+		score float64
+	}{
+		{behaviorForward, forward * (1 - backward)},
+		{behaviorReversal, backward * (1 - forward) * (1 - ventralBend)},
+		{behaviorOmega, backward * ventralBend * 2},
+		{behaviorPumping, pumping * (1 - muscles)},
+		{behaviorPause, (1 - math.Max(forward, backward)) * (1 - muscles) * (1 - pumping)},
+	}
+
+	var best behavior
+	var bestScore, total float64
+	for _, s := range scores {
+		total += s.score
+		if s.score > bestScore {
+			best.Label = s.label
+			bestScore = s.score
+		}
+	}
+	if total == 0 {
+		return behavior{Label: behaviorPause, Confidence: 0}
+	}
+	best.Confidence = bestScore / total
+
+	return best
+}
@@ -0,0 +1,41 @@
+package nema
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time of the worm's world.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// simClock is a simulated clock. It starts at a fixed time and advances by a
+// fixed tick every time it is read, so two runs that read it the same number
+// of times see the same times.
+type simClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	tick time.Duration
+}
+
+// NewSimClock creates a simulated clock starting at start.
+func NewSimClock(start time.Time, tick time.Duration) *simClock {
+	return &simClock{now: start.UTC(), tick: tick}
+}
+
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now
+	c.now = c.now.Add(c.tick)
+	return now
+}
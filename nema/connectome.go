@@ -0,0 +1,233 @@
+package nema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Synapse types
+const (
+	synapseChemical   = "chemical"
+	synapseElectrical = "electrical"
+)
+
+// synapse is a single weighted connection between two neurons. Chemical
+// synapses are directed from Pre to Post and a negative weight is an inhibitory
+// synapse. Electrical synapses (gap junctions) are symmetric and the order of
+// Pre and Post does not matter.
+type synapse struct {
+	Pre    string  `json:"pre"`
+	Post   string  `json:"post"`
+	Weight float64 `json:"weight"`
+}
+
+// connectome holds the wiring of the nervous system. Neuron names are the same
+// keys used in the neuro state maps (e.g. "N_AVAL").
+type connectome struct {
+	chemical   []synapse
+	electrical []synapse
+}
+
+// add adds a synapse of the given type to the connectome.
+func (c *connectome) add(typ string, s synapse) error {
+	switch typ {
+	case synapseChemical:
+		c.chemical = append(c.chemical, s)
+	case synapseElectrical:
+		if s.Weight < 0 {
+			return fmt.Errorf("negative gap junction weight for %s <-> %s", s.Pre, s.Post)
+		}
+		c.electrical = append(c.electrical, s)
+	default:
+		return fmt.Errorf("unknown synapse type %q for %s -> %s", typ, s.Pre, s.Post)
+	}
+	return nil
+}
+
+// LoadConnectome loads the connectome from a local CSV or JSON file. The
+// connectome bundled with the service is used when path is empty. The bundled
+// data is a reduced wiring diagram covering the touch, chemosensory,
+// thermosensory and locomotion circuits.
+//
+// CSV files may use any of the following layouts, detected from the header:
+//
+//   - pre,post,type,weight with type "chemical" or "electrical"
+//   - the Varshney et al. (2011) layout: Neuron 1,Neuron 2,Type,Nbr
+//   - the Cook et al. (2019) edge list layout: Source,Target,Weight,Type
+//
+// JSON files contain an array of objects with pre, post, type and weight
+// fields.
+func LoadConnectome(path string) (*connectome, error) {
+	data, format, err := readData(path, "connectome.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	var c *connectome
+	switch format {
+	case formatCSV:
+		c, err = parseConnectomeCSV(bytes.NewReader(data))
+	case formatJSON:
+		c, err = parseConnectomeJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing connectome: %w", err)
+	}
+
+	return c, nil
+}
+
+func parseConnectomeJSON(data []byte) (*connectome, error) {
+	var edges []struct {
+		Pre    string  `json:"pre"`
+		Post   string  `json:"post"`
+		Type   string  `json:"type"`
+		Weight float64 `json:"weight"`
+	}
+	if err := json.Unmarshal(data, &edges); err != nil {
+		return nil, err
+	}
+
+	c := &connectome{}
+	for _, e := range edges {
+		s := synapse{Pre: neuronKey(e.Pre), Post: neuronKey(e.Post), Weight: e.Weight}
+		if err := c.add(e.Type, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// csvLayout describes the columns of a connectome CSV file.
+type csvLayout struct {
+	header []string
+	// pre, post, typ and weight are the column indexes of each field
+	pre, post, typ, weight int
+	// synapseType maps the type column to a synapse type. An empty result
+	// skips the row.
+	synapseType func(string) string
+	// symmetric is true when the layout lists every gap junction from both
+	// sides. Only the first of the two rows is kept.
+	symmetric bool
+	// merge sums the weights of the chemical synapses listed more than once
+	// between the same pair of neurons.
+	merge bool
+}
+
+var csvLayouts = []csvLayout{
+	{
+		header: []string{"pre", "post", "type", "weight"},
+		pre:    0, post: 1, typ: 2, weight: 3,
+		synapseType: func(t string) string { return t },
+	},
+	{
+		// Varshney et al. list every chemical synapse twice, once as sent (S,
+		// Sp) and once as received (R, Rp). A pair with both monadic (S) and
+		// polyadic (Sp) synapses has a row of each, which are merged into one
+		// synapse. Neuromuscular junctions (NMJ) are not attached to a named
+		// muscle and are skipped.
+		header: []string{"neuron 1", "neuron 2", "type", "nbr"},
+		pre:    0, post: 1, typ: 2, weight: 3,
+		synapseType: func(t string) string {
+			switch t {
+			case "S", "Sp":
+				return synapseChemical
+			case "EJ":
+				return synapseElectrical
+			default:
+				return ""
+			}
+		},
+		symmetric: true,
+		merge:     true,
+	},
+	{
+		header: []string{"source", "target", "weight", "type"},
+		pre:    0, post: 1, weight: 2, typ: 3,
+		synapseType: func(t string) string { return strings.ToLower(t) },
+		symmetric:   true,
+	},
+}
+
+func parseConnectomeCSV(r io.Reader) (*connectome, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	i := slices.IndexFunc(csvLayouts, func(l csvLayout) bool {
+		return slices.Equal(l.header, header)
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("unknown connectome layout %q", strings.Join(header, ","))
+	}
+	layout := csvLayouts[i]
+
+	c := &connectome{}
+	seen := make(map[[2]string]bool)
+	// merged holds the position of each merged chemical synapse
+	merged := make(map[[2]string]int)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %w", err)
+		}
+
+		typ := layout.synapseType(record[layout.typ])
+		if typ == "" {
+			continue
+		}
+
+		weight, err := strconv.ParseFloat(record[layout.weight], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %q for %s -> %s: %w", record[layout.weight], record[layout.pre], record[layout.post], err)
+		}
+
+		s := synapse{
+			Pre:    neuronKey(record[layout.pre]),
+			Post:   neuronKey(record[layout.post]),
+			Weight: weight,
+		}
+
+		if layout.symmetric && typ == synapseElectrical {
+			pair := [2]string{min(s.Pre, s.Post), max(s.Pre, s.Post)}
+			if seen[pair] {
+				continue
+			}
+			seen[pair] = true
+		}
+
+		if layout.merge && typ == synapseChemical {
+			pair := [2]string{s.Pre, s.Post}
+			if i, ok := merged[pair]; ok {
+				c.chemical[i].Weight += s.Weight
+				continue
+			}
+			merged[pair] = len(c.chemical)
+		}
+
+		if err := c.add(typ, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,124 @@
+package nema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConnectomeCSV(t *testing.T) {
+	tests := []struct {
+		name       string
+		csv        string
+		chemical   []synapse
+		electrical []synapse
+		err        string
+	}{
+		{
+			name: "native layout",
+			csv: "pre,post,type,weight\n" +
+				"ALML,AVDL,chemical,3\n" +
+				"AVDL,AVAL,chemical,-2\n" +
+				"AVAL,AVAR,electrical,4\n" +
+				"AVAR,AVAL,electrical,4\n",
+			chemical: []synapse{
+				{Pre: "N_ALML", Post: "N_AVDL", Weight: 3},
+				{Pre: "N_AVDL", Post: "N_AVAL", Weight: -2},
+			},
+			// The native layout lists every gap junction as given
+			electrical: []synapse{
+				{Pre: "N_AVAL", Post: "N_AVAR", Weight: 4},
+				{Pre: "N_AVAR", Post: "N_AVAL", Weight: 4},
+			},
+		},
+		{
+			name: "varshney skips received and nmj rows",
+			csv: "Neuron 1,Neuron 2,Type,Nbr\n" +
+				"ALML,AVDL,S,3\n" +
+				"AVDL,ALML,R,3\n" +
+				"AVDL,ALML,Rp,1\n" +
+				"DA01,NMJ,NMJ,7\n",
+			chemical: []synapse{
+				{Pre: "N_ALML", Post: "N_AVDL", Weight: 3},
+			},
+		},
+		{
+			name: "varshney merges monadic and polyadic rows",
+			csv: "Neuron 1,Neuron 2,Type,Nbr\n" +
+				"ALML,AVDL,S,3\n" +
+				"ALML,AVDL,Sp,2\n" +
+				"AVDL,ALML,R,3\n" +
+				"AVDL,ALML,Rp,2\n" +
+				"AVDL,ALML,Sp,1\n",
+			chemical: []synapse{
+				{Pre: "N_ALML", Post: "N_AVDL", Weight: 5},
+				{Pre: "N_AVDL", Post: "N_ALML", Weight: 1},
+			},
+		},
+		{
+			name: "varshney keeps one row per gap junction",
+			csv: "Neuron 1,Neuron 2,Type,Nbr\n" +
+				"AVAL,AVAR,EJ,4\n" +
+				"AVAR,AVAL,EJ,4\n" +
+				"AVAL,PVCL,EJ,1\n",
+			electrical: []synapse{
+				{Pre: "N_AVAL", Post: "N_AVAR", Weight: 4},
+				{Pre: "N_AVAL", Post: "N_PVCL", Weight: 1},
+			},
+		},
+		{
+			name: "cook keeps one row per gap junction",
+			csv: "Source,Target,Weight,Type\n" +
+				"ALML,AVDL,3,chemical\n" +
+				"AVAL,AVAR,4,electrical\n" +
+				"AVAR,AVAL,4,electrical\n",
+			chemical: []synapse{
+				{Pre: "N_ALML", Post: "N_AVDL", Weight: 3},
+			},
+			electrical: []synapse{
+				{Pre: "N_AVAL", Post: "N_AVAR", Weight: 4},
+			},
+		},
+		{
+			name: "unknown layout",
+			csv:  "from,to,kind,count\n",
+			err:  "unknown connectome layout",
+		},
+		{
+			name: "unknown type",
+			csv:  "pre,post,type,weight\nALML,AVDL,hormonal,1\n",
+			err:  `unknown synapse type "hormonal"`,
+		},
+		{
+			name: "negative gap junction",
+			csv:  "pre,post,type,weight\nAVAL,AVAR,electrical,-1\n",
+			err:  "negative gap junction weight",
+		},
+		{
+			name: "invalid weight",
+			csv:  "Source,Target,Weight,Type\nALML,AVDL,many,chemical\n",
+			err:  `invalid weight "many"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseConnectomeCSV(strings.NewReader(tt.csv))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(c.chemical, tt.chemical) {
+				t.Errorf("got chemical synapses %v, want %v", c.chemical, tt.chemical)
+			}
+			if !reflect.DeepEqual(c.electrical, tt.electrical) {
+				t.Errorf("got electrical synapses %v, want %v", c.electrical, tt.electrical)
+			}
+		})
+	}
+}
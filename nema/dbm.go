@@ -5,13 +5,26 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/tmc/langchaingo/llms"
 )
 
+// DefaultWorm is the ID of the public Nema. Rows saved before there were
+// several worms belong to her.
+const DefaultWorm = "nema"
+
+// wormColumn is the definition of the worm_id column of the tables that had
+// rows before there were worms.
+const wormColumn = "TEXT NOT NULL DEFAULT '" + DefaultWorm + "'"
+
+// dbm gives access to the rows of a single worm. Use Worm to get the rows of
+// another worm of the same database.
 type dbm struct {
-	db *sql.DB
+	db     *sql.DB
+	wormID string
 }
 
 func NewDBManager(dataSourceName string) (*dbm, error) {
@@ -19,40 +32,305 @@ func NewDBManager(dataSourceName string) (*dbm, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &dbm{db: db}, nil
+	return &dbm{db: db, wormID: DefaultWorm}, nil
+}
+
+// OpenDBReadOnly opens an existing database for reading only. It never creates
+// or migrates the database, so it fails when the file does not exist or has
+// not been initiated by the current version of the service.
+func OpenDBReadOnly(path string) (*dbm, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	m := &dbm{db: db, wormID: DefaultWorm}
+
+	// The sleep column is the last one the migrations add to the states
+	initiated, err := m.hasColumn("neural_states", "sleep")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if !initiated {
+		db.Close()
+		return nil, fmt.Errorf("database %s is not initiated or is from an older version, run the service on it first", path)
+	}
+
+	return m, nil
+}
+
+// Worm returns a manager of the same database for the rows of the given worm.
+func (m *dbm) Worm(id string) *dbm {
+	return &dbm{db: m.db, wormID: id}
+}
+
+// The tables that had no worm_id column before there were several worms and
+// whose primary key includes it now. They are rebuilt with these schemas when
+// an older database is initiated.
+const (
+	synapseWeightsSchema = /* sql */ `
+	CREATE TABLE IF NOT EXISTS synapse_weights (
+		worm_id         TEXT    NOT NULL,
+		pre             TEXT    NOT NULL,
+		post            TEXT    NOT NULL,
+		factor          REAL    NOT NULL,     -- learned factor applied to the connectome weight
+		neural_state_id INTEGER NOT NULL,     -- state the factor was last saved with
+
+		PRIMARY KEY(worm_id, pre, post),
+		FOREIGN KEY(worm_id) REFERENCES worms(id),
+		FOREIGN KEY(neural_state_id) REFERENCES neural_states(id)
+	);
+	`
+
+	habituationSchema = /* sql */ `
+	CREATE TABLE IF NOT EXISTS habituation (
+		worm_id         TEXT    NOT NULL,
+		neuron          TEXT    NOT NULL,
+		level           REAL    NOT NULL,     -- fraction of the response lost, between 0 and 1
+		neural_state_id INTEGER NOT NULL,     -- state the level was last saved with
+
+		PRIMARY KEY(worm_id, neuron),
+		FOREIGN KEY(worm_id) REFERENCES worms(id),
+		FOREIGN KEY(neural_state_id) REFERENCES neural_states(id)
+	);
+	`
+
+	lesionsSchema = /* sql */ `
+	CREATE TABLE IF NOT EXISTS lesions (
+		worm_id    TEXT      NOT NULL,
+		neuron     TEXT      NOT NULL,
+		kind       TEXT      NOT NULL,     -- ablate, silence or clamp
+		value      INTEGER   NOT NULL,     -- value the neuron is held at
+		created_at TIMESTAMP NOT NULL,
+
+		PRIMARY KEY(worm_id, neuron),
+		FOREIGN KEY(worm_id) REFERENCES worms(id)
+	);
+	`
+)
+
+// Close closes the database.
+func (m *dbm) Close() error {
+	return m.db.Close()
 }
 
 // Initiate builds the schema for the database
 func (m *dbm) Initiate() error {
 	schema := /* sql */ `
+	CREATE TABLE IF NOT EXISTS worms (
+		id         TEXT      NOT NULL PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL
+	);
+
 	CREATE TABLE IF NOT EXISTS neural_states (
 		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		worm_id         ` + wormColumn + `,
 		state_count     INTEGER   NOT NULL,
 		updated_at      TIMESTAMP NOT NULL,
 		motor_neurons   TEXT      NOT NULL,     -- JSON string of motor neuron states
-		sensory_neurons TEXT      NOT NULL    -- JSON string of sensory neuron states
+		sensory_neurons TEXT      NOT NULL,     -- JSON string of sensory neuron states
+		environment     TEXT      NOT NULL DEFAULT '{}', -- JSON string of the worm's position on the plate
+		modulators      TEXT      NOT NULL DEFAULT '{}', -- JSON string of neuromodulator levels
+		behavior        TEXT      NOT NULL DEFAULT '{}', -- JSON string of the classified behavior
+		lifecycle       TEXT      NOT NULL DEFAULT '{}', -- JSON string of the age, stage and satiety
+		sleep           TEXT      NOT NULL DEFAULT '{}', -- JSON string of the sleep state
+
+		FOREIGN KEY(worm_id) REFERENCES worms(id)
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_neural_states_updated_at ON neural_states(updated_at);
 
 	CREATE TABLE IF NOT EXISTS prompts (
 		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		worm_id         ` + wormColumn + `,
 		neural_state_id INTEGER NOT NULL,
 		question        TEXT NOT NULL,
 		response        TEXT NOT NULL,
+		reasoning       TEXT NOT NULL DEFAULT '', -- discarded reasoning of the LLM
 		completed_at    TIMESTAMP NOT NULL,
 
+		FOREIGN KEY(worm_id) REFERENCES worms(id),
 		FOREIGN KEY(neural_state_id) REFERENCES neural_states(id)
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_prompts_neural_state_id ON prompts(neural_state_id);
-	`
+
+	CREATE TABLE IF NOT EXISTS stimuli (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		neural_state_id INTEGER NOT NULL,
+		type            TEXT    NOT NULL,
+		intensity       REAL    NOT NULL,
+		duration        INTEGER NOT NULL,
+		applied_at      TIMESTAMP NOT NULL,
+
+		FOREIGN KEY(neural_state_id) REFERENCES neural_states(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_stimuli_neural_state_id ON stimuli(neural_state_id);
+
+	CREATE TABLE IF NOT EXISTS sleep_bouts (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		worm_id     TEXT      NOT NULL,
+		started_at  TIMESTAMP NOT NULL,
+		ended_at    TIMESTAMP,              -- NULL while the worm is still asleep
+		wake_reason TEXT,
+
+		FOREIGN KEY(worm_id) REFERENCES worms(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sleep_bouts_worm_id ON sleep_bouts(worm_id, started_at);
+
+	CREATE TABLE IF NOT EXISTS conversation_messages (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		worm_id    TEXT      NOT NULL,
+		role       TEXT      NOT NULL,           -- human, ai or summary
+		content    TEXT      NOT NULL,
+		compacted  BOOLEAN   NOT NULL DEFAULT 0, -- folded into a later summary
+		created_at TIMESTAMP NOT NULL,
+
+		FOREIGN KEY(worm_id) REFERENCES worms(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_conversation_messages_worm_id ON conversation_messages(worm_id, compacted, id);
+	` + synapseWeightsSchema + habituationSchema + lesionsSchema
 
 	// Execute the schema creation
 	if _, err := m.db.Exec(schema); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
+	// Add the columns that were introduced after the tables were first created
+	if err := m.addColumn("neural_states", "environment", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+	if err := m.addColumn("neural_states", "modulators", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+	if err := m.addColumn("neural_states", "behavior", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+	if err := m.addColumn("neural_states", "lifecycle", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+	if err := m.addColumn("neural_states", "sleep", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+	if err := m.addColumn("neural_states", "worm_id", wormColumn); err != nil {
+		return err
+	}
+	if err := m.addColumn("prompts", "worm_id", wormColumn); err != nil {
+		return err
+	}
+	if err := m.addColumn("prompts", "reasoning", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Rebuild the tables whose primary key now includes the worm
+	for _, t := range []struct{ table, schema, columns string }{
+		{"synapse_weights", synapseWeightsSchema, "pre, post, factor, neural_state_id"},
+		{"habituation", habituationSchema, "neuron, level, neural_state_id"},
+		{"lesions", lesionsSchema, "neuron, kind, value, created_at"},
+	} {
+		if err := m.addWormKey(t.table, t.schema, t.columns); err != nil {
+			return err
+		}
+	}
+
+	indexes := /* sql */ `
+	CREATE INDEX IF NOT EXISTS idx_neural_states_worm_id ON neural_states(worm_id, updated_at);
+	CREATE INDEX IF NOT EXISTS idx_neural_states_worm_id_id ON neural_states(worm_id, id);
+	CREATE INDEX IF NOT EXISTS idx_prompts_worm_id ON prompts(worm_id);
+	`
+	if _, err := m.db.Exec(indexes); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	// The public Nema always exists
+	if _, err := m.db.Exec(`INSERT OR IGNORE INTO worms (id, created_at) VALUES (?, ?)`, DefaultWorm, time.Now()); err != nil {
+		return fmt.Errorf("failed to create default worm: %w", err)
+	}
+
+	return nil
+}
+
+// hasColumn tells whether a table has a column.
+func (m *dbm) hasColumn(table, column string) (bool, error) {
+	rows, err := m.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan columns of %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+
+	return false, nil
+}
+
+// addColumn adds a column to an existing table if the table does not have it
+// yet.
+func (m *dbm) addColumn(table, column, definition string) error {
+	ok, err := m.hasColumn(table, column)
+	if err != nil || ok {
+		return err
+	}
+
+	q := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := m.db.Exec(q); err != nil {
+		return fmt.Errorf("failed to add column %s to %s: %w", column, table, err)
+	}
+
+	return nil
+}
+
+// addWormKey rebuilds a table without a worm_id column with the given schema
+// and copies the given columns of its rows over to the default worm. SQLite
+// cannot change the primary key of an existing table.
+func (m *dbm) addWormKey(table, schema, columns string) error {
+	ok, err := m.hasColumn(table, "worm_id")
+	if err != nil || ok {
+		return err
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s_old", table, table),
+		schema,
+		fmt.Sprintf("INSERT INTO %s (worm_id, %s) SELECT '%s', %s FROM %s_old", table, columns, DefaultWorm, columns, table),
+		fmt.Sprintf("DROP TABLE %s_old", table),
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			return fmt.Errorf("failed to add worm_id to %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %s: %w", table, err)
+	}
+
 	return nil
 }
 
@@ -61,23 +339,39 @@ func (m *dbm) Initiate() error {
 func (m *dbm) saveState(n neuro) (int, error) {
 	q := /* sql */ `
 		INSERT INTO neural_states
-			(state_count, updated_at, motor_neurons, sensory_neurons)
-		VALUES (?, ?, ?, ?)
+			(worm_id, state_count, updated_at, motor_neurons, sensory_neurons, environment, modulators, behavior, lifecycle, sleep)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		RETURNING id
 	`
 
-	// Marshal the neuron maps to JSON strings
-	motorJSON, err := json.Marshal(n.MotorNeurons)
+	// Marshal the neuron values to the JSON strings of the motor and sensory
+	// neuron maps
+	motorJSON, sensoryJSON := n.motorJSON(), n.sensoryJSON()
+	environmentJSON, err := json.Marshal(n.Environment)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal environment: %w", err)
+	}
+	modulatorsJSON, err := json.Marshal(n.Modulators)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal modulators: %w", err)
+	}
+	behaviorJSON, err := json.Marshal(n.Behavior)
 	if err != nil {
-		return 0, fmt.Errorf("failed to marshal motor neurons: %w", err)
+		return 0, fmt.Errorf("failed to marshal behavior: %w", err)
 	}
-	sensoryJSON, err := json.Marshal(n.SensoryNeurons)
+	lifecycleJSON, err := json.Marshal(n.Lifecycle)
 	if err != nil {
-		return 0, fmt.Errorf("failed to marshal sensory neurons: %w", err)
+		return 0, fmt.Errorf("failed to marshal lifecycle: %w", err)
+	}
+	sleepJSON, err := json.Marshal(n.Sleep)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal sleep: %w", err)
 	}
 
 	var id int
-	if err := m.db.QueryRow(q, n.StateCount, n.UpdatedAt, string(motorJSON), string(sensoryJSON)).Scan(&id); err != nil {
+	err = m.db.QueryRow(q, m.wormID, n.StateCount, n.UpdatedAt, string(motorJSON), string(sensoryJSON),
+		string(environmentJSON), string(modulatorsJSON), string(behaviorJSON), string(lifecycleJSON), string(sleepJSON)).Scan(&id)
+	if err != nil {
 		return 0, fmt.Errorf("failed to save nema: %w", err)
 	}
 
@@ -85,11 +379,11 @@ func (m *dbm) saveState(n neuro) (int, error) {
 }
 
 // savePrompt saves the prompt to the database
-func (m *dbm) savePrompt(stateID int, prompt string, response llmResponse) error {
+func (m *dbm) savePrompt(stateID int, prompt string, response llmResponse, completedAt time.Time) error {
 	q := /* sql */ `
 		INSERT INTO prompts
-			(neural_state_id, question, response, completed_at)
-		VALUES (?, ?, ?, ?)
+			(worm_id, neural_state_id, question, response, reasoning, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
 
 	responseJSON, err := json.Marshal(response)
@@ -97,28 +391,414 @@ func (m *dbm) savePrompt(stateID int, prompt string, response llmResponse) error
 		return fmt.Errorf("failed to marshal response: %w", err)
 	}
 
-	if _, err := m.db.Exec(q, stateID, prompt, string(responseJSON), time.Now()); err != nil {
+	if _, err := m.db.Exec(q, m.wormID, stateID, prompt, string(responseJSON), response.Reasoning, completedAt); err != nil {
 		return fmt.Errorf("failed to save prompt: %w", err)
 	}
 
 	return nil
 }
 
+// saveStimulus saves a stimulus applied to the worm to the database
+func (m *dbm) saveStimulus(stateID int, s Stimulus, appliedAt time.Time) error {
+	q := /* sql */ `
+		INSERT INTO stimuli
+			(neural_state_id, type, intensity, duration, applied_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	if _, err := m.db.Exec(q, stateID, s.Type, s.Intensity, s.Duration, appliedAt); err != nil {
+		return fmt.Errorf("failed to save stimulus: %w", err)
+	}
+
+	return nil
+}
+
+// saveLearning saves the learned synapse weights and habituation levels that
+// differ from the saved ones, and deletes those that are gone. Nothing is
+// written when nothing changed.
+func (m *dbm) saveLearning(stateID int, l, saved learning) error {
+	var changedWeights, goneWeights []synapseKey
+	for k, factor := range l.weights {
+		if f, ok := saved.weights[k]; !ok || f != factor {
+			changedWeights = append(changedWeights, k)
+		}
+	}
+	for k := range saved.weights {
+		if _, ok := l.weights[k]; !ok {
+			goneWeights = append(goneWeights, k)
+		}
+	}
+	var changedLevels, goneLevels []string
+	for neuron, level := range l.habituation {
+		if h, ok := saved.habituation[neuron]; !ok || h != level {
+			changedLevels = append(changedLevels, neuron)
+		}
+	}
+	for neuron := range saved.habituation {
+		if _, ok := l.habituation[neuron]; !ok {
+			goneLevels = append(goneLevels, neuron)
+		}
+	}
+	if len(changedWeights)+len(goneWeights)+len(changedLevels)+len(goneLevels) == 0 {
+		return nil
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, k := range changedWeights {
+		q := /* sql */ `
+			INSERT OR REPLACE INTO synapse_weights (worm_id, pre, post, factor, neural_state_id)
+			VALUES (?, ?, ?, ?, ?)
+		`
+		if _, err := tx.Exec(q, m.wormID, k.Pre, k.Post, l.weights[k], stateID); err != nil {
+			return fmt.Errorf("failed to save synapse weight: %w", err)
+		}
+	}
+	for _, k := range goneWeights {
+		q := `DELETE FROM synapse_weights WHERE worm_id = ? AND pre = ? AND post = ?`
+		if _, err := tx.Exec(q, m.wormID, k.Pre, k.Post); err != nil {
+			return fmt.Errorf("failed to delete synapse weight: %w", err)
+		}
+	}
+
+	for _, neuron := range changedLevels {
+		q := /* sql */ `
+			INSERT OR REPLACE INTO habituation (worm_id, neuron, level, neural_state_id)
+			VALUES (?, ?, ?, ?)
+		`
+		if _, err := tx.Exec(q, m.wormID, neuron, l.habituation[neuron], stateID); err != nil {
+			return fmt.Errorf("failed to save habituation: %w", err)
+		}
+	}
+	for _, neuron := range goneLevels {
+		q := `DELETE FROM habituation WHERE worm_id = ? AND neuron = ?`
+		if _, err := tx.Exec(q, m.wormID, neuron); err != nil {
+			return fmt.Errorf("failed to delete habituation: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit learning: %w", err)
+	}
+
+	return nil
+}
+
+// getLearning gets the learned synapse weights and habituation levels
+func (m *dbm) getLearning() (learning, error) {
+	l := learning{
+		weights:     make(map[synapseKey]float64),
+		habituation: make(map[string]float64),
+	}
+
+	rows, err := m.db.Query(`SELECT pre, post, factor FROM synapse_weights WHERE worm_id = ?`, m.wormID)
+	if err != nil {
+		return learning{}, fmt.Errorf("failed to get synapse weights: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k synapseKey
+		var factor float64
+		if err := rows.Scan(&k.Pre, &k.Post, &factor); err != nil {
+			return learning{}, fmt.Errorf("failed to scan synapse weight: %w", err)
+		}
+		l.weights[k] = factor
+	}
+	if err := rows.Err(); err != nil {
+		return learning{}, fmt.Errorf("failed to get synapse weights: %w", err)
+	}
+
+	rows, err = m.db.Query(`SELECT neuron, level FROM habituation WHERE worm_id = ?`, m.wormID)
+	if err != nil {
+		return learning{}, fmt.Errorf("failed to get habituation: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var neuron string
+		var level float64
+		if err := rows.Scan(&neuron, &level); err != nil {
+			return learning{}, fmt.Errorf("failed to scan habituation: %w", err)
+		}
+		l.habituation[neuron] = level
+	}
+	if err := rows.Err(); err != nil {
+		return learning{}, fmt.Errorf("failed to get habituation: %w", err)
+	}
+
+	return l, nil
+}
+
+// saveLesions saves lesions together, replacing any earlier lesion of the same
+// neurons
+func (m *dbm) saveLesions(ls []Lesion) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	q := /* sql */ `
+		INSERT OR REPLACE INTO lesions (worm_id, neuron, kind, value, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	for _, l := range ls {
+		if _, err := tx.Exec(q, m.wormID, l.Neuron, l.Kind, l.Value, l.Since); err != nil {
+			return fmt.Errorf("failed to save lesion: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit lesions: %w", err)
+	}
+
+	return nil
+}
+
+// deleteLesions deletes the lesions of the neurons together
+func (m *dbm) deleteLesions(neurons []string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, neuron := range neurons {
+		if _, err := tx.Exec(`DELETE FROM lesions WHERE worm_id = ? AND neuron = ?`, m.wormID, neuron); err != nil {
+			return fmt.Errorf("failed to delete lesion: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit lesions: %w", err)
+	}
+
+	return nil
+}
+
+// getLesions gets the lesioned neurons
+func (m *dbm) getLesions() (lesions, error) {
+	rows, err := m.db.Query(`SELECT neuron, kind, value, created_at FROM lesions WHERE worm_id = ?`, m.wormID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lesions: %w", err)
+	}
+	defer rows.Close()
+
+	l := make(lesions)
+	for rows.Next() {
+		var lesion Lesion
+		if err := rows.Scan(&lesion.Neuron, &lesion.Kind, &lesion.Value, &lesion.Since); err != nil {
+			return nil, fmt.Errorf("failed to scan lesion: %w", err)
+		}
+		l[lesion.Neuron] = lesion
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get lesions: %w", err)
+	}
+
+	return l, nil
+}
+
+// startSleep starts a sleep bout
+func (m *dbm) startSleep(at time.Time) error {
+	q := /* sql */ `
+		INSERT INTO sleep_bouts (worm_id, started_at)
+		VALUES (?, ?)
+	`
+
+	if _, err := m.db.Exec(q, m.wormID, at); err != nil {
+		return fmt.Errorf("failed to start sleep bout: %w", err)
+	}
+
+	return nil
+}
+
+// endSleep ends the ongoing sleep bout
+func (m *dbm) endSleep(at time.Time, reason string) error {
+	q := /* sql */ `
+		UPDATE sleep_bouts
+		SET ended_at = ?, wake_reason = ?
+		WHERE worm_id = ? AND ended_at IS NULL
+	`
+
+	if _, err := m.db.Exec(q, at, reason, m.wormID); err != nil {
+		return fmt.Errorf("failed to end sleep bout: %w", err)
+	}
+
+	return nil
+}
+
+// getSleepBouts gets the last sleep bouts, most recent first by insertion
+func (m *dbm) getSleepBouts(limit int) ([]sleepBout, error) {
+	q := /* sql */ `
+		SELECT started_at, ended_at, wake_reason
+		FROM sleep_bouts
+		WHERE worm_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	rows, err := m.db.Query(q, m.wormID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sleep bouts: %w", err)
+	}
+	defer rows.Close()
+
+	bouts := []sleepBout{}
+	for rows.Next() {
+		var b sleepBout
+		var end sql.NullTime
+		var reason sql.NullString
+		if err := rows.Scan(&b.Start, &end, &reason); err != nil {
+			return nil, fmt.Errorf("failed to scan sleep bout: %w", err)
+		}
+		if end.Valid {
+			b.End = &end.Time
+		}
+		b.WakeReason = reason.String
+		bouts = append(bouts, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get sleep bouts: %w", err)
+	}
+
+	return bouts, nil
+}
+
+// roleSummary is the role of the running summary of the compacted messages.
+const roleSummary = "summary"
+
+// saveMessages saves messages of the conversation in order
+func (m *dbm) saveMessages(messages []llms.MessageContent, at time.Time) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	q := /* sql */ `
+		INSERT INTO conversation_messages (worm_id, role, content, created_at)
+		VALUES (?, ?, ?, ?)
+	`
+	for _, message := range messages {
+		if _, err := tx.Exec(q, m.wormID, string(message.Role), messageText(message), at); err != nil {
+			return fmt.Errorf("failed to save message: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit messages: %w", err)
+	}
+
+	return nil
+}
+
+// compactMessages marks the given number of oldest messages and the previous
+// summary as compacted and saves the summary that replaces them
+func (m *dbm) compactMessages(count int, summary string, at time.Time) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	q := /* sql */ `
+		UPDATE conversation_messages
+		SET compacted = 1
+		WHERE id IN (
+			SELECT id FROM conversation_messages
+			WHERE worm_id = ? AND compacted = 0 AND role != ?
+			ORDER BY id
+			LIMIT ?
+		)
+	`
+	if _, err := tx.Exec(q, m.wormID, roleSummary, count); err != nil {
+		return fmt.Errorf("failed to compact messages: %w", err)
+	}
+
+	q = /* sql */ `
+		UPDATE conversation_messages
+		SET compacted = 1
+		WHERE worm_id = ? AND compacted = 0 AND role = ?
+	`
+	if _, err := tx.Exec(q, m.wormID, roleSummary); err != nil {
+		return fmt.Errorf("failed to compact summary: %w", err)
+	}
+
+	q = /* sql */ `
+		INSERT INTO conversation_messages (worm_id, role, content, created_at)
+		VALUES (?, ?, ?, ?)
+	`
+	if _, err := tx.Exec(q, m.wormID, roleSummary, summary, at); err != nil {
+		return fmt.Errorf("failed to save summary: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit compaction: %w", err)
+	}
+
+	return nil
+}
+
+// getConversation gets the running summary and the messages of the
+// conversation that were not compacted, oldest first
+func (m *dbm) getConversation() (string, []llms.MessageContent, error) {
+	q := /* sql */ `
+		SELECT role, content
+		FROM conversation_messages
+		WHERE worm_id = ? AND compacted = 0
+		ORDER BY id
+	`
+
+	rows, err := m.db.Query(q, m.wormID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	defer rows.Close()
+
+	var summary string
+	var messages []llms.MessageContent
+	for rows.Next() {
+		var role, content string
+		if err := rows.Scan(&role, &content); err != nil {
+			return "", nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if role == roleSummary {
+			summary = content
+			continue
+		}
+		messages = append(messages, llms.TextParts(llms.ChatMessageType(role), content))
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	return summary, messages, nil
+}
+
 var errNoState = errors.New("no state found")
 
-// getState gets the neural state from the database
+// getState gets the last saved neural state from the database. States are
+// ordered by insertion, as the simulated clock restarts at the same time on
+// every deterministic run.
 func (m *dbm) getState() (neuro, error) {
 	q := /* sql */ `
-		SELECT state_count, updated_at, motor_neurons, sensory_neurons
+		SELECT state_count, updated_at, motor_neurons, sensory_neurons, environment, modulators, behavior, lifecycle, sleep
 		FROM neural_states
-		ORDER BY updated_at DESC
+		WHERE worm_id = ?
+		ORDER BY id DESC
 		LIMIT 1
 	`
 
-	var n neuro
-	var motorJSON, sensoryJSON string
+	var stateCount int
+	var updatedAt time.Time
+	var motorJSON, sensoryJSON, environmentJSON, modulatorsJSON, behaviorJSON, lifecycleJSON, sleepJSON string
 
-	err := m.db.QueryRow(q).Scan(&n.StateCount, &n.UpdatedAt, &motorJSON, &sensoryJSON)
+	err := m.db.QueryRow(q, m.wormID).Scan(&stateCount, &updatedAt, &motorJSON, &sensoryJSON,
+		&environmentJSON, &modulatorsJSON, &behaviorJSON, &lifecycleJSON, &sleepJSON)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return neuro{}, errNoState
@@ -127,12 +807,95 @@ func (m *dbm) getState() (neuro, error) {
 	}
 
 	// Unmarshal the JSON strings back into maps
-	if err := json.Unmarshal([]byte(motorJSON), &n.MotorNeurons); err != nil {
+	var motor, sensory map[string]int
+	if err := json.Unmarshal([]byte(motorJSON), &motor); err != nil {
 		return neuro{}, fmt.Errorf("failed to unmarshal motor neurons: %w", err)
 	}
-	if err := json.Unmarshal([]byte(sensoryJSON), &n.SensoryNeurons); err != nil {
+	if err := json.Unmarshal([]byte(sensoryJSON), &sensory); err != nil {
 		return neuro{}, fmt.Errorf("failed to unmarshal sensory neurons: %w", err)
 	}
 
+	n := neuroFromMaps(motor, sensory)
+	n.StateCount = stateCount
+	n.UpdatedAt = updatedAt
+	if err := json.Unmarshal([]byte(environmentJSON), &n.Environment); err != nil {
+		return neuro{}, fmt.Errorf("failed to unmarshal environment: %w", err)
+	}
+	if err := json.Unmarshal([]byte(modulatorsJSON), &n.Modulators); err != nil {
+		return neuro{}, fmt.Errorf("failed to unmarshal modulators: %w", err)
+	}
+	if err := json.Unmarshal([]byte(behaviorJSON), &n.Behavior); err != nil {
+		return neuro{}, fmt.Errorf("failed to unmarshal behavior: %w", err)
+	}
+	if err := json.Unmarshal([]byte(lifecycleJSON), &n.Lifecycle); err != nil {
+		return neuro{}, fmt.Errorf("failed to unmarshal lifecycle: %w", err)
+	}
+	if err := json.Unmarshal([]byte(sleepJSON), &n.Sleep); err != nil {
+		return neuro{}, fmt.Errorf("failed to unmarshal sleep: %w", err)
+	}
+	// States saved before the worm had a lifecycle are of a grown worm
+	if n.Lifecycle.Stage == "" {
+		n.Lifecycle = adultLifecycle()
+	}
+
 	return n, nil
 }
+
+// LoadState gets the latest neural state together with what the worm has
+// learned and its lesions
+func (m *dbm) LoadState() (neuro, error) {
+	n, err := m.getState()
+	if err != nil {
+		return neuro{}, err
+	}
+	n.learning, err = m.getLearning()
+	if err != nil {
+		return neuro{}, err
+	}
+	n.lesions, err = m.getLesions()
+	if err != nil {
+		return neuro{}, err
+	}
+	return n, nil
+}
+
+// errWormExists is returned when creating a worm whose ID is taken.
+var errWormExists = errors.New("worm already exists")
+
+// createWorm adds a worm to the registry
+func (m *dbm) createWorm(id string, createdAt time.Time) error {
+	res, err := m.db.Exec(`INSERT OR IGNORE INTO worms (id, created_at) VALUES (?, ?)`, id, createdAt)
+	if err != nil {
+		return fmt.Errorf("failed to create worm: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to create worm: %w", err)
+	} else if n == 0 {
+		return errWormExists
+	}
+
+	return nil
+}
+
+// getWorms gets every worm in the registry, oldest first
+func (m *dbm) getWorms() ([]Worm, error) {
+	rows, err := m.db.Query(`SELECT id, created_at FROM worms ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worms: %w", err)
+	}
+	defer rows.Close()
+
+	var worms []Worm
+	for rows.Next() {
+		var w Worm
+		if err := rows.Scan(&w.ID, &w.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan worm: %w", err)
+		}
+		worms = append(worms, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get worms: %w", err)
+	}
+
+	return worms, nil
+}
@@ -0,0 +1,148 @@
+package nema
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DecayConfig holds the settings of the homeostatic decay that relaxes the
+// neurons towards their resting values between interactions.
+type DecayConfig struct {
+	// Interval is the time between two decay ticks. Zero disables the decay.
+	Interval time.Duration
+	// MotorHalfLife and SensoryHalfLife are the times it takes a motor or
+	// sensory neuron to get halfway back to its resting value.
+	MotorHalfLife   time.Duration
+	SensoryHalfLife time.Duration
+	// Checkpoint is the time between two saves of a decayed state.
+	Checkpoint time.Duration
+}
+
+// DefaultDecayConfig lets sensory neurons calm down within minutes and motor
+// neurons a bit slower, and saves the relaxing worm every five minutes.
+var DefaultDecayConfig = DecayConfig{
+	Interval:        10 * time.Second,
+	MotorHalfLife:   5 * time.Minute,
+	SensoryHalfLife: 2 * time.Minute,
+	Checkpoint:      5 * time.Minute,
+}
+
+// decayFactor returns the fraction of its distance to rest a neuron keeps
+// after an interval.
+func decayFactor(interval, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		return 0
+	}
+	return math.Pow(0.5, float64(interval)/float64(halfLife))
+}
+
+// relax moves every neuron that is not lesioned towards its resting value,
+// keeping the fraction of its distance given for its group. RIS stays active
+// while the worm sleeps. It rounds towards rest so neurons do settle instead
+// of hovering a unit away, and returns whether any value changed.
+func relax(n *neuro, motor, sensory float64, resting func(string) float64) bool {
+	changed := false
+	for i, value := range n.values {
+		name := n.index.names[i]
+		if n.lesioned(name) || (n.Sleep.Asleep && name == risNeuron) {
+			continue
+		}
+		factor := sensory
+		if n.index.motor[i] {
+			factor = motor
+		}
+		rest := resting(name)
+		v := rest + (float64(value)-rest)*factor
+		if float64(value) > rest {
+			v = math.Floor(v)
+		} else {
+			v = math.Ceil(v)
+		}
+		if next := int8(clampValue(v)); next != value {
+			n.values[i] = next
+			changed = true
+		}
+	}
+	return changed
+}
+
+// RunDecay relaxes the neurons of every worm towards their resting values on
+// every tick and saves the state of a worm whenever a checkpoint is due and its
+// state has decayed since the last save. It blocks until the context is done.
+func (w *Worms) RunDecay(ctx context.Context) {
+	if w.cfg.Decay.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(w.cfg.Decay.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, m := range w.running() {
+				m.decayTick(now)
+			}
+		}
+	}
+}
+
+// decayTick relaxes the neurons by one decay interval and saves the state when
+// a checkpoint is due.
+func (m *Manager) decayTick(now time.Time) {
+	if m.lastCheckpoint.IsZero() {
+		m.lastCheckpoint = now
+	}
+	checkpoint := now.Sub(m.lastCheckpoint) >= m.decay.Checkpoint
+	if checkpoint {
+		m.lastCheckpoint = now
+	}
+	if err := m.decayStep(checkpoint); err != nil {
+		m.log.Error("error saving decayed state", zap.Error(err))
+	}
+}
+
+// decayStep relaxes the neurons and ages the worm by one decay interval and,
+// when asked to, saves the state if it has decayed since the last save.
+func (m *Manager) decayStep(checkpoint bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resting := func(name string) float64 {
+		return m.sim.neuronParams(name).Resting
+	}
+	motor := decayFactor(m.decay.Interval, m.decay.MotorHalfLife)
+	sensory := decayFactor(m.decay.Interval, m.decay.SensoryHalfLife)
+	if relax(&m.state, motor, sensory, resting) {
+		m.decayed = true
+	}
+
+	// The worm keeps ageing and digesting between interactions. Her age and
+	// gut drift on every tick and are saved once they have drifted far
+	// enough, while a new stage or hunger waking her up is worth a save of
+	// its own.
+	wasAsleep, stage := m.state.Sleep.Asleep, m.state.Lifecycle.Stage
+	m.state.Lifecycle.advance(m.decay.Interval, m.state.Environment.Food)
+	m.state.Sleep.rest(m.decay.Interval)
+	m.state.Sleep.update(&m.state)
+	m.trackSleep(wasAsleep)
+	if m.state.Sleep.Asleep != wasAsleep || m.state.Lifecycle.Stage != stage ||
+		m.state.Lifecycle.drifted(m.saved) {
+		m.decayed = true
+	}
+
+	if !checkpoint || !m.decayed {
+		return nil
+	}
+	if _, err := m.saveState(); err != nil {
+		return err
+	}
+	m.log.Info("decayed state saved", zap.Int("state_count", m.state.StateCount))
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package nema_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/brainsonchain/nema/mock"
+	"github.com/brainsonchain/nema/nema"
+)
+
+// deterministicRun prompts and stimulates a worm in deterministic mode and
+// returns every saved state as a row of text.
+func deterministicRun(t *testing.T, mode string, seed int64) []string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "nema.db")
+	db, err := nema.NewDBManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Initiate(); err != nil {
+		t.Fatal(err)
+	}
+
+	roster, err := nema.LoadRoster("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := nema.LoadRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectome, err := nema.LoadConnectome("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := nema.LoadNeuronParams("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := nema.NewNeuronModel("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := nema.NewManager(zap.NewNop(), db, nema.Config{
+		InitialPrompt: "You are Nema. %s",
+		LLM:           &mock.MockLLM{},
+		Roster:        roster,
+		Registry:      registry,
+		Simulator: nema.NewSimulator(connectome, nema.SimConfig{
+			Model:      model,
+			Params:     params,
+			Plasticity: nema.DefaultPlasticityConfig,
+			Noise:      2,
+			Seed:       uint64(seed),
+		}),
+		Clock:         nema.NewSimClock(time.Unix(seed, 0), time.Second),
+		Deterministic: true,
+		Seed:          int(seed),
+		Mode:          mode,
+		// A small budget compacts the conversation during the run
+		Window: nema.WindowConfig{TokenBudget: 2000, KeepTurns: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i := range 5 {
+		if _, err := m.AskLLM(ctx, fmt.Sprintf("Hello Nema, this is message %d", i)); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []nema.Stimulus{
+			{Type: "anterior_touch", Intensity: 0.7, Duration: 10},
+			{Type: "food", Intensity: 1, Duration: 20},
+			{Type: "odor", Intensity: 0.4, Duration: 5},
+		} {
+			if _, err := m.ApplyStimulus(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Read the states back with every column as saved
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`SELECT * FROM neural_states ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []string
+	for rows.Next() {
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatal(err)
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = string(v)
+		}
+		states = append(states, strings.Join(fields, "|"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return states
+}
+
+func TestDeterministicRuns(t *testing.T) {
+	for _, mode := range []string{nema.ModeDirect, nema.ModeHybrid} {
+		t.Run(mode, func(t *testing.T) {
+			first := deterministicRun(t, mode, 42)
+			second := deterministicRun(t, mode, 42)
+
+			if len(first) < 20 {
+				t.Fatalf("got %d states, want at least 20", len(first))
+			}
+			if !slices.Equal(first, second) {
+				for i := range min(len(first), len(second)) {
+					if first[i] != second[i] {
+						t.Fatalf("state %d differs:\n%s\n%s", i+1, first[i], second[i])
+					}
+				}
+				t.Fatalf("got %d and %d states", len(first), len(second))
+			}
+
+			// Another seed must change the run, or the test would pass
+			// without the noise ever being drawn
+			if other := deterministicRun(t, mode, 43); slices.Equal(first, other) {
+				t.Error("a different seed produced the same states")
+			}
+		})
+	}
+}
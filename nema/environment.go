@@ -0,0 +1,172 @@
+package nema
+
+import (
+	"fmt"
+	"math"
+)
+
+// plate describes the agar plate the worm lives on. Distances are in mm and
+// the plate is centered at the origin.
+type plate struct {
+	Radius float64
+	// The food (bacterial lawn) and salt are gaussian spots with a peak
+	// concentration of 1.
+	FoodX, FoodY, FoodSpread float64
+	SaltX, SaltY, SaltSpread float64
+	// The temperature rises linearly along the x axis from CenterTemperature
+	// at the origin. CultivationTemperature is the temperature the worm was
+	// raised at and seeks out.
+	CenterTemperature      float64
+	TemperatureGradient    float64
+	CultivationTemperature float64
+}
+
+// defaultPlate is a standard 90 mm petri dish with a food patch on one side, a
+// salt spot on the other and a shallow temperature gradient.
+var defaultPlate = plate{
+	Radius:                 45,
+	FoodX:                  15,
+	FoodY:                  0,
+	FoodSpread:             8,
+	SaltX:                  -15,
+	SaltY:                  10,
+	SaltSpread:             15,
+	CenterTemperature:      20,
+	TemperatureGradient:    0.1,
+	CultivationTemperature: 20,
+}
+
+func gaussian(x, y, cx, cy, spread float64) float64 {
+	d2 := (x-cx)*(x-cx) + (y-cy)*(y-cy)
+	return math.Exp(-d2 / (2 * spread * spread))
+}
+
+func (p plate) food(x, y float64) float64 {
+	return gaussian(x, y, p.FoodX, p.FoodY, p.FoodSpread)
+}
+
+func (p plate) salt(x, y float64) float64 {
+	return gaussian(x, y, p.SaltX, p.SaltY, p.SaltSpread)
+}
+
+func (p plate) temperature(x, y float64) float64 {
+	return p.CenterTemperature + p.TemperatureGradient*x
+}
+
+const (
+	// maxSpeed is the distance in mm the worm crawls in a single step when
+	// its forward or backward motor neurons are fully active.
+	maxSpeed = 0.25
+	// turnGain converts the bend of the head into a change of heading per
+	// step.
+	turnGain = 0.5
+	// headSegments is the number of segments from the head used to steer.
+	headSegments = 4
+
+	// Sensory gains convert what the worm senses into input to the sensory
+	// neurons. Changes over a single step are small, so the gains of the
+	// neurons that respond to changes are much larger.
+	odorGain              = 60
+	odorChangeGain        = 2000
+	saltChangeGain        = 2000
+	temperatureGain       = 10
+	temperatureChangeGain = 200
+)
+
+// environment is the position of the worm on the plate and what it sensed
+// there during the last step.
+type environment struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	// Heading is the direction the head points to in radians.
+	Heading     float64 `json:"heading"`
+	Food        float64 `json:"food"`
+	Salt        float64 `json:"salt"`
+	Temperature float64 `json:"temperature"`
+	// Steps is the number of steps the worm has spent on the plate.
+	Steps int `json:"steps"`
+}
+
+// sense returns the input to the sensory neurons for the worm's current
+// position and records what it sensed. AWA responds to the food odor itself,
+// while AWC responds to its removal. ASEL and ASER respond to increases and
+// decreases of salt. AFD responds to the temperature relative to the
+// cultivation temperature and to its changes.
+func (e *environment) sense(p plate) map[string]float64 {
+	food := p.food(e.X, e.Y)
+	salt := p.salt(e.X, e.Y)
+	temperature := p.temperature(e.X, e.Y)
+
+	// Nothing has changed the first time the worm senses the plate
+	if e.Steps == 0 {
+		e.Food, e.Salt, e.Temperature = food, salt, temperature
+	}
+
+	dFood := food - e.Food
+	dSalt := salt - e.Salt
+	dTemperature := temperature - e.Temperature
+	e.Food, e.Salt, e.Temperature = food, salt, temperature
+
+	afd := temperatureGain*(temperature-p.CultivationTemperature) + temperatureChangeGain*dTemperature
+
+	return map[string]float64{
+		"N_AWAL": odorGain * food,
+		"N_AWAR": odorGain * food,
+		"N_AWCL": -odorChangeGain * dFood,
+		"N_AWCR": -odorChangeGain * dFood,
+		"N_ASEL": saltChangeGain * dSalt,
+		"N_ASER": -saltChangeGain * dSalt,
+		"N_AFDL": afd,
+		"N_AFDR": afd,
+	}
+}
+
+// cordNeurons returns the keys of a numbered class of ventral cord motor
+// neurons, e.g. "N_VB1" to "N_VB11".
+func cordNeurons(class string, count int) []string {
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("N_%s%d", class, i+1)
+	}
+	return names
+}
+
+// The classes of ventral cord motor neurons driving forward (VB, DB) and
+// backward (VA, DA) crawling
+var (
+	vbNeurons = cordNeurons("VB", 11)
+	dbNeurons = cordNeurons("DB", 7)
+	vaNeurons = cordNeurons("VA", 12)
+	daNeurons = cordNeurons("DA", 9)
+)
+
+// move crawls the worm according to its motor output. The balance between the
+// forward (VB, DB) and backward (VA, DA) motor neurons sets the speed and the
+// bend of the head steers. The worm turns around when it reaches the edge of
+// the plate.
+func (e *environment) move(p plate, n *neuro) {
+	forward := (activity(n, vbNeurons...) + activity(n, dbNeurons...)) / 2
+	backward := (activity(n, vaNeurons...) + activity(n, daNeurons...)) / 2
+	speed := maxSpeed * (forward - backward)
+
+	segments := computePosture(n).Segments
+	var headBend float64
+	for _, s := range segments[:headSegments] {
+		headBend += s.Curvature
+	}
+	if speed != 0 {
+		e.Heading += turnGain * headBend * math.Copysign(1, speed)
+	}
+
+	e.X += speed * math.Cos(e.Heading)
+	e.Y += speed * math.Sin(e.Heading)
+
+	if r := math.Hypot(e.X, e.Y); r > p.Radius {
+		e.X *= p.Radius / r
+		e.Y *= p.Radius / r
+		e.Heading += math.Pi
+	}
+	e.Heading = math.Remainder(e.Heading, 2*math.Pi)
+
+	e.Steps++
+}
@@ -0,0 +1,103 @@
+package nema
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// errNoJSON is returned when an answer of the LLM holds no JSON object.
+var errNoJSON = errors.New("the answer holds no JSON object")
+
+// reasoningBlock matches the reasoning reasoning models wrap in tags, e.g. the
+// <think> blocks of DeepSeek-R1 and QwQ.
+var reasoningBlock = regexp.MustCompile(`(?s)<(think|thinking|reasoning)>(.*?)</(?:think|thinking|reasoning)>`)
+
+// extraction is an answer of the LLM split into the JSON object it holds and
+// what was discarded around it.
+type extraction struct {
+	JSON string
+	// Reasoning is the content of the reasoning blocks.
+	Reasoning string
+	// Discarded is the prose and markdown around the JSON object.
+	Discarded string
+}
+
+// stripReasoning removes the reasoning blocks from an answer and returns the
+// rest together with the reasoning. Ollama drops the opening tag of some
+// models, so everything before a lone closing tag is reasoning too, as is an
+// unterminated block cut off by the token limit.
+func stripReasoning(content string) (string, string) {
+	var reasoning []string
+	content = reasoningBlock.ReplaceAllStringFunc(content, func(block string) string {
+		reasoning = append(reasoning, strings.TrimSpace(reasoningBlock.FindStringSubmatch(block)[2]))
+		return ""
+	})
+
+	for _, tag := range []string{"think", "thinking", "reasoning"} {
+		if i := strings.Index(content, "</"+tag+">"); i >= 0 {
+			reasoning = append(reasoning, strings.TrimSpace(content[:i]))
+			content = content[i+len(tag)+3:]
+		}
+		if i := strings.Index(content, "<"+tag+">"); i >= 0 {
+			reasoning = append(reasoning, strings.TrimSpace(content[i+len(tag)+2:]))
+			content = content[:i]
+		}
+	}
+
+	return strings.TrimSpace(content), strings.Join(reasoning, "\n\n")
+}
+
+// extractResponse finds the first balanced JSON object in an answer of the
+// LLM, skipping reasoning blocks, prose and code fences with or without a
+// language tag.
+func extractResponse(content string) (extraction, error) {
+	rest, reasoning := stripReasoning(content)
+	ex := extraction{Reasoning: reasoning}
+
+	for start := strings.IndexByte(rest, '{'); start >= 0; {
+		end := balancedObject(rest[start:])
+		if end > 0 && json.Valid([]byte(rest[start:start+end])) {
+			ex.JSON = rest[start : start+end]
+			ex.Discarded = strings.TrimSpace(rest[:start] + "\n" + rest[start+end:])
+			return ex, nil
+		}
+
+		next := strings.IndexByte(rest[start+1:], '{')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+
+	ex.Discarded = rest
+	return ex, errNoJSON
+}
+
+// balancedObject returns the length of the object s starts with, counting
+// braces outside of strings, or 0 if the object is never closed.
+func balancedObject(s string) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package nema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExtractResponse(t *testing.T) {
+	const answer = `{"human_message": "Hi!", "motor_neurons": [], "sensory_neurons": [], "changed": false}`
+
+	tests := []struct {
+		name      string
+		content   string
+		json      string
+		reasoning string
+		err       error
+	}{
+		{
+			name:    "openai plain json",
+			content: answer,
+			json:    answer,
+		},
+		{
+			name:    "openai json fence",
+			content: "```json\n" + answer + "\n```",
+			json:    answer,
+		},
+		{
+			name:    "openai prose before fence",
+			content: "Here is Nema's response:\n\n```json\n" + answer + "\n```\n\nLet me know if you need anything else.",
+			json:    answer,
+		},
+		{
+			name:    "ollama fence without language tag",
+			content: "```\n" + answer + "\n```",
+			json:    answer,
+		},
+		{
+			name: "ollama deepseek-r1 think block",
+			content: "<think>\nOkay, the user says hi. Nema is a worm, so she can't really talk, " +
+				"but I should answer in JSON like {\"human_message\": ...}. No neurons change.\n</think>\n\n" +
+				"```json\n" + answer + "\n```",
+			json: answer,
+			reasoning: "Okay, the user says hi. Nema is a worm, so she can't really talk, " +
+				"but I should answer in JSON like {\"human_message\": ...}. No neurons change.",
+		},
+		{
+			name:      "ollama think without opening tag",
+			content:   "The prompt is a greeting, nothing is sensed.\n</think>\n\n" + answer,
+			json:      answer,
+			reasoning: "The prompt is a greeting, nothing is sensed.",
+		},
+		{
+			name:    "braces inside strings",
+			content: `Sure! {"human_message": "I curl into a } and a { \"shape\"", "changed": false} Hope that helps.`,
+			json:    `{"human_message": "I curl into a } and a { \"shape\"", "changed": false}`,
+		},
+		{
+			name:    "invalid object before the answer",
+			content: "The schema is {human_message, changed}.\n" + answer,
+			json:    answer,
+		},
+		{
+			name:      "think block cut off by the token limit",
+			content:   "<think>\nLet me think about which motor neurons",
+			reasoning: "Let me think about which motor neurons",
+			err:       errNoJSON,
+		},
+		{
+			name:    "prose only",
+			content: "I'm sorry, I can't help with that.",
+			err:     errNoJSON,
+		},
+		{
+			name:    "unbalanced object",
+			content: `{"human_message": "Hi!", "changed": false`,
+			err:     errNoJSON,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex, err := extractResponse(tt.content)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if ex.JSON != tt.json {
+				t.Errorf("got JSON %q, want %q", ex.JSON, tt.json)
+			}
+			if ex.Reasoning != tt.reasoning {
+				t.Errorf("got reasoning %q, want %q", ex.Reasoning, tt.reasoning)
+			}
+		})
+	}
+}
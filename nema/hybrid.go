@@ -0,0 +1,175 @@
+package nema
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"go.uber.org/zap"
+)
+
+// Modes of AskLLM
+const (
+	// ModeDirect lets the LLM write the neuron values itself.
+	ModeDirect = "direct"
+	// ModeHybrid only lets the LLM interpret the prompt as stimuli. The
+	// simulation computes the neuron values and the LLM replies from the
+	// resulting state.
+	ModeHybrid = "hybrid"
+)
+
+// InterpretPrefix starts the prompt that interprets a message as stimuli and
+// ReplySuffix ends the prompt that asks for the reply in hybrid mode. They are
+// exported so the mock LLM can tell the prompts apart.
+const (
+	InterpretPrefix = "You translate messages sent to Nema"
+	ReplySuffix     = `Answer only with a JSON object like {"human_message": "..."}.`
+)
+
+// stimulusDescriptions tell the LLM what each stimulus type stands for.
+var stimulusDescriptions = map[string]string{
+	"tap":             "a tap on the plate, felt along the whole body",
+	"anterior_touch":  "a gentle touch on the head or front half of the body",
+	"posterior_touch": "a gentle touch on the tail",
+	"nose_touch":      "a touch on the tip of the nose or a harsh, noxious poke",
+	"nacl":            "salt",
+	"odor":            "an attractive smell, e.g. diacetyl or isoamyl alcohol",
+	"heat":            "warmth",
+	"cold":            "cold",
+	"food":            "bacteria to eat",
+}
+
+// interpretPrompt asks the LLM to turn a message into stimuli. It is sent on
+// its own, outside the conversation, so the interpretation does not depend on
+// what Nema said before.
+func interpretPrompt(prompt string) string {
+	var types []string
+	for t := range stimulusTargets {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+
+	var b strings.Builder
+	b.WriteString(InterpretPrefix + ", a C. elegans worm, into the physical stimuli the worm would sense. ")
+	b.WriteString("The stimulus types are:\n")
+	for _, t := range types {
+		fmt.Fprintf(&b, "- %s: %s\n", t, stimulusDescriptions[t])
+	}
+	fmt.Fprintf(&b, "Each stimulus has an intensity between 0 and 1 and a duration between 1 and %d simulation steps. ", maxStimulusDuration)
+	b.WriteString("Messages the worm cannot physically sense have no stimuli.\n")
+	b.WriteString(`Answer only with a JSON object like {"stimuli": [{"type": "anterior_touch", "intensity": 0.5, "duration": 10}]}.`)
+	b.WriteString("\n\nMessage: ")
+	b.WriteString(prompt)
+	return b.String()
+}
+
+// replyPrompt gives the LLM the prompt together with the stimuli it was
+// interpreted as and the resulting state, and asks it to reply as Nema.
+func replyPrompt(prompt string, stimuli []Stimulus, n *neuro) string {
+	var b strings.Builder
+	b.WriteString(prompt)
+	b.WriteString("\n\n")
+	if len(stimuli) == 0 {
+		b.WriteString("You did not sense anything.")
+	} else {
+		b.WriteString("You sensed:")
+		for _, s := range stimuli {
+			fmt.Fprintf(&b, " %s (intensity %.2f, %d steps);", s.Type, s.Intensity, s.Duration)
+		}
+		b.WriteString(" Your state is now:\n")
+		b.WriteString(n.JSONString())
+	}
+	fmt.Fprintf(&b, "\nYou are currently doing: %s (confidence %.2f).\n", n.Behavior.Label, n.Behavior.Confidence)
+	b.WriteString(n.physiology())
+	b.WriteString("\n")
+	b.WriteString("Reply as Nema from this state. Do not change any neurons. " + ReplySuffix)
+	return b.String()
+}
+
+// askHybrid interprets the prompt as stimuli, applies them to the worm and
+// asks the LLM to reply from the resulting state. The LLM never writes neuron
+// values in this mode. It must be called with the lock held.
+func (m *Manager) askHybrid(ctx context.Context, prompt string) (llmResponse, error) {
+	stimuli, err := m.interpret(ctx, prompt)
+	if err != nil {
+		return llmResponse{}, err
+	}
+
+	// Save the stimulated state before asking for the reply, so the state
+	// stays explained by its stimuli even if the reply fails
+	var id int
+	if len(stimuli) > 0 {
+		m.log.Info("prompt interpreted as stimuli, updating state", zap.Any("stimuli", stimuli))
+		m.stimulate(stimuli)
+
+		id, err = m.saveState()
+		if err != nil {
+			return llmResponse{}, fmt.Errorf("error updating state: %w", err)
+		}
+		now := m.clock.Now()
+		for _, s := range stimuli {
+			if err := m.db.saveStimulus(id, s, now); err != nil {
+				return llmResponse{}, fmt.Errorf("error saving stimulus: %w", err)
+			}
+		}
+	} else {
+		m.log.Info("no stimuli in prompt, skipping update")
+		m.state.Behavior = classifyBehavior(&m.state)
+	}
+
+	human := llms.TextParts(llms.ChatMessageTypeHuman, replyPrompt(prompt, stimuli, &m.state))
+	m.fitWindow(ctx, human)
+
+	var lr llmResponse
+	answer, err := m.ask(ctx, append(m.history(), human), func(response string) error {
+		var err error
+		lr, err = parseReply(response)
+		return err
+	})
+	if err != nil {
+		return llmResponse{}, err
+	}
+	lr.Reasoning = answer.Reasoning
+
+	if err := m.remember(human, llms.TextParts(llms.ChatMessageTypeAI, answer.JSON)); err != nil {
+		return llmResponse{}, err
+	}
+
+	// Only the reply is taken from the LLM
+	lr.Changed = len(stimuli) > 0
+	lr.Stimuli = stimuli
+
+	if lr.Changed {
+		if err := m.db.savePrompt(id, prompt, lr, m.clock.Now()); err != nil {
+			return llmResponse{}, fmt.Errorf("error saving prompt: %w", err)
+		}
+	}
+
+	lr.Behavior = m.state.Behavior
+	lr.Asleep = m.state.Sleep.Asleep
+
+	m.log.Info("response", zap.Any("response", lr))
+
+	return lr, nil
+}
+
+// interpret asks the LLM which stimuli the prompt stands for. Stimuli the
+// simulation cannot apply are sent back to be fixed.
+func (m *Manager) interpret(ctx context.Context, prompt string) ([]Stimulus, error) {
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, interpretPrompt(prompt)),
+	}
+
+	var stimuli []Stimulus
+	_, err := m.ask(ctx, messages, func(response string) error {
+		var err error
+		stimuli, err = parseStimuli(response)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stimuli, nil
+}
@@ -0,0 +1,84 @@
+package nema
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+)
+
+// neuronIndex is the table mapping neuron names to their position in the
+// dense state. Neurons are sorted by name so two states with the same neurons
+// share the same layout, and it is never modified once built so states can
+// share it.
+type neuronIndex struct {
+	names []string
+	// quoted are the names as JSON strings, ready to be written out.
+	quoted [][]byte
+	// motor tells whether each neuron is kept with the motor neurons in the
+	// state JSON. The others are kept with the sensory neurons.
+	motor     []bool
+	positions map[string]int
+}
+
+// newNeuronIndex builds the index of the given motor and sensory neurons. A
+// neuron listed in both groups is kept as a motor neuron.
+func newNeuronIndex(motor, sensory []string) *neuronIndex {
+	groups := make(map[string]bool, len(motor)+len(sensory))
+	for _, name := range sensory {
+		groups[name] = false
+	}
+	for _, name := range motor {
+		groups[name] = true
+	}
+
+	x := &neuronIndex{positions: make(map[string]int, len(groups))}
+	for name := range groups {
+		x.names = append(x.names, name)
+	}
+	slices.Sort(x.names)
+	for i, name := range x.names {
+		quoted, _ := json.Marshal(name)
+		x.quoted = append(x.quoted, quoted)
+		x.motor = append(x.motor, groups[name])
+		x.positions[name] = i
+	}
+	return x
+}
+
+// len returns the number of neurons in the index.
+func (x *neuronIndex) len() int {
+	if x == nil {
+		return 0
+	}
+	return len(x.names)
+}
+
+// position returns the position of a neuron in the dense state.
+func (x *neuronIndex) position(name string) (int, bool) {
+	if x == nil {
+		return 0, false
+	}
+	i, ok := x.positions[name]
+	return i, ok
+}
+
+// appendJSON appends the values of the neurons of one group as a JSON object
+// to buf. It is the same JSON as marshalling the legacy name to value map of
+// the group, without building the map.
+func (x *neuronIndex) appendJSON(buf []byte, values []int8, motor bool) []byte {
+	buf = append(buf, '{')
+	first := true
+	for i, quoted := range x.quoted {
+		if x.motor[i] != motor {
+			continue
+		}
+		if !first {
+			buf = append(buf, ',')
+		}
+		first = false
+		buf = append(buf, quoted...)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(values[i]), 10)
+	}
+	return append(buf, '}')
+}
@@ -0,0 +1,214 @@
+package nema
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Kinds of lesion
+const (
+	// LesionAblate kills the neuron. It is held at 0, releases no
+	// transmitter and its gap junctions are cut.
+	LesionAblate = "ablate"
+	// LesionSilence holds the neuron at its resting value and stops it
+	// releasing transmitter. Its gap junctions still conduct.
+	LesionSilence = "silence"
+	// LesionClamp holds the neuron at a fixed value. It keeps transmitting as
+	// usual.
+	LesionClamp = "clamp"
+)
+
+// ErrInvalidLesion is returned when a lesion has an unknown kind or target or
+// its value is out of range.
+var ErrInvalidLesion = errors.New("invalid lesion")
+
+// Lesion is an experimental manipulation of a single neuron. The neuron is
+// held at Value by the simulation, the decay and the LLM until the lesion is
+// removed.
+type Lesion struct {
+	Neuron string `json:"neuron"`
+	Kind   string `json:"kind"`
+	// Value is the value the neuron is held at.
+	Value int       `json:"value"`
+	Since time.Time `json:"since"`
+}
+
+// lesions are the lesioned neurons by name.
+type lesions map[string]Lesion
+
+// neurons returns the lesioned neurons sorted by name.
+func (l lesions) neurons() []string {
+	neurons := make([]string, 0, len(l))
+	for name := range l {
+		neurons = append(neurons, name)
+	}
+	slices.Sort(neurons)
+	return neurons
+}
+
+// list returns the lesions sorted by neuron.
+func (l lesions) list() []Lesion {
+	list := make([]Lesion, 0, len(l))
+	for _, name := range l.neurons() {
+		list = append(list, l[name])
+	}
+	return list
+}
+
+// lesioned tells whether a neuron is held by a lesion.
+func (n *neuro) lesioned(neuron string) bool {
+	_, ok := n.lesions[neuron]
+	return ok
+}
+
+// holdLesions sets every lesioned neuron to the value it is held at.
+func (n *neuro) holdLesions() {
+	for _, l := range n.lesions {
+		n.set(l.Neuron, l.Value)
+	}
+}
+
+// lesionKinds returns the kind of lesion of each neuron in the dense state,
+// or nil when no neuron is lesioned.
+func (n *neuro) lesionKinds() []string {
+	if len(n.lesions) == 0 {
+		return nil
+	}
+	kinds := make([]string, len(n.values))
+	for _, l := range n.lesions {
+		if i, ok := n.index.position(l.Neuron); ok {
+			kinds[i] = l.Kind
+		}
+	}
+	return kinds
+}
+
+// resolve returns the neurons a lesion target stands for. The target is a
+// single neuron (e.g. "AVAL" or "N_AVAL"), an anatomical class of the
+// registry (e.g. "AVA") or one of the registry classes (e.g. "interneuron").
+func (r *registry) resolve(target string) []string {
+	var neurons []string
+	if slices.Contains(neuronClasses, target) {
+		for _, info := range r.class(target) {
+			neurons = append(neurons, info.Name)
+		}
+		return neurons
+	}
+
+	key := neuronKey(target)
+	if key == "" {
+		return nil
+	}
+	if _, ok := r.info(key); ok {
+		return []string{key}
+	}
+
+	class := strings.TrimPrefix(key, "N_")
+	for _, info := range r.neurons {
+		if info.CellClass == class {
+			neurons = append(neurons, info.Name)
+		}
+	}
+	return neurons
+}
+
+// Lesion ablates, silences or clamps every neuron of the target and saves the
+// resulting state. The value is only used to clamp. It returns the lesions
+// that were applied.
+func (m *Manager) Lesion(target, kind string, value int) ([]Lesion, error) {
+	switch kind {
+	case LesionAblate, LesionSilence:
+	case LesionClamp:
+		if !validValue(value) {
+			return nil, fmt.Errorf("%w: value %d must be between -128 and 127", ErrInvalidLesion, value)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidLesion, kind)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	neurons := m.registry.resolve(target)
+	if len(neurons) == 0 {
+		return nil, fmt.Errorf("%w: unknown target %q", ErrInvalidLesion, target)
+	}
+
+	now := m.clock.Now()
+	var applied []Lesion
+	for _, neuron := range neurons {
+		l := Lesion{Neuron: neuron, Kind: kind, Since: now}
+		switch kind {
+		case LesionSilence:
+			l.Value = clampValue(m.sim.neuronParams(neuron).Resting)
+		case LesionClamp:
+			l.Value = value
+		}
+		applied = append(applied, l)
+	}
+
+	// A class is lesioned as a whole or not at all
+	if err := m.db.saveLesions(applied); err != nil {
+		return nil, err
+	}
+	for _, l := range applied {
+		m.state.lesions[l.Neuron] = l
+	}
+	m.state.holdLesions()
+
+	if _, err := m.saveState(); err != nil {
+		return nil, fmt.Errorf("error updating state: %w", err)
+	}
+
+	m.log.Info("neurons lesioned", zap.String("target", target), zap.String("kind", kind), zap.Int("neurons", len(applied)))
+
+	return applied, nil
+}
+
+// RemoveLesion reverses the lesions of every neuron of the target. The neurons
+// carry on from the value they were held at. An empty target removes every
+// lesion. It returns the lesions that were removed.
+func (m *Manager) RemoveLesion(target string) ([]Lesion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	neurons := m.state.lesions.neurons()
+	if target != "" {
+		neurons = m.registry.resolve(target)
+		if len(neurons) == 0 {
+			return nil, fmt.Errorf("%w: unknown target %q", ErrInvalidLesion, target)
+		}
+	}
+
+	var removed []Lesion
+	var lesioned []string
+	for _, neuron := range neurons {
+		if l, ok := m.state.lesions[neuron]; ok {
+			removed = append(removed, l)
+			lesioned = append(lesioned, neuron)
+		}
+	}
+	if err := m.db.deleteLesions(lesioned); err != nil {
+		return nil, err
+	}
+	for _, neuron := range lesioned {
+		delete(m.state.lesions, neuron)
+	}
+
+	m.log.Info("lesions removed", zap.String("target", target), zap.Int("neurons", len(removed)))
+
+	return removed, nil
+}
+
+// Lesions returns the current lesions sorted by neuron.
+func (m *Manager) Lesions() []Lesion {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state.lesions.list()
+}
@@ -0,0 +1,101 @@
+package nema
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegistryResolve(t *testing.T) {
+	r, err := LoadRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		neurons []string
+		// count is checked instead of neurons for the large classes
+		count int
+	}{
+		{name: "neuron", target: "AVAL", neurons: []string{"N_AVAL"}},
+		{name: "neuron with prefix", target: "N_AVAL", neurons: []string{"N_AVAL"}},
+		{name: "unpaired neuron", target: "AVL", neurons: []string{"N_AVL"}},
+		{name: "bilateral class", target: "AVA", neurons: []string{"N_AVAL", "N_AVAR"}},
+		{name: "class not matching its prefix", target: "AVD", neurons: []string{"N_AVDL", "N_AVDR"}},
+		{name: "prefix of several classes", target: "AV"},
+		{name: "prefix of a class", target: "SM"},
+		{
+			name:    "dorsal and ventral class",
+			target:  "SMD",
+			neurons: []string{"N_SMDDL", "N_SMDDR", "N_SMDVL", "N_SMDVR"},
+		},
+		{
+			name:    "class with unpaired members",
+			target:  "RME",
+			neurons: []string{"N_RMED", "N_RMEL", "N_RMER", "N_RMEV"},
+		},
+		{name: "class that is not a dorsal variant", target: "RID", neurons: []string{"N_RID"}},
+		{name: "class with a dorsal lookalike", target: "RIV", neurons: []string{"N_RIVL", "N_RIVR"}},
+		{name: "numbered class", target: "VA", count: 12},
+		{name: "numbered neuron", target: "VA01", neurons: []string{"N_VA1"}},
+		{name: "numbered classes are separate", target: "I", neurons: nil},
+		{name: "registry class", target: "pharyngeal", count: len(r.class(classPharyngeal))},
+		{name: "unknown", target: "XYZ"},
+		{name: "empty", target: " "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			neurons := r.resolve(tt.target)
+			if tt.count > 0 {
+				if len(neurons) != tt.count {
+					t.Errorf("got %d neurons, want %d", len(neurons), tt.count)
+				}
+				return
+			}
+			slices.Sort(neurons)
+			if !slices.Equal(neurons, tt.neurons) {
+				t.Errorf("got %s, want %s", strings.Join(neurons, ","), strings.Join(tt.neurons, ","))
+			}
+		})
+	}
+}
+
+func TestLesionClass(t *testing.T) {
+	m := newTestManager(t, &scriptedLLM{}, 0)
+
+	applied, err := m.Lesion("SMD", LesionClamp, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 4 {
+		t.Fatalf("got %d lesions, want 4", len(applied))
+	}
+	saved, err := m.db.getLesions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.neurons(); !slices.Equal(got, []string{"N_SMDDL", "N_SMDDR", "N_SMDVL", "N_SMDVR"}) {
+		t.Errorf("got saved lesions %v", got)
+	}
+	if value, _ := m.state.value("N_SMDVR"); value != 50 {
+		t.Errorf("got clamped value %d, want 50", value)
+	}
+
+	removed, err := m.RemoveLesion("SMD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 4 {
+		t.Fatalf("got %d removed lesions, want 4", len(removed))
+	}
+	saved, err = m.db.getLesions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 0 || len(m.state.lesions) != 0 {
+		t.Errorf("got %d saved and %d held lesions after removal", len(saved), len(m.state.lesions))
+	}
+}
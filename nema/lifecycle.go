@@ -0,0 +1,168 @@
+package nema
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Developmental stages
+const (
+	stageL1    = "L1"
+	stageL2    = "L2"
+	stageL3    = "L3"
+	stageL4    = "L4"
+	stageAdult = "adult"
+	stageDauer = "dauer"
+)
+
+const (
+	// stepDuration is the simulated time a simulation step lasts.
+	stepDuration = time.Second
+
+	// eatRate is how fast the gut fills per hour on food of concentration 1.
+	eatRate = 10.0
+	// digestionHours is the time constant over which the gut empties.
+	digestionHours = 2.0
+	// energyHours is the time constant over which the energy stores follow
+	// how full the gut is.
+	energyHours = 12.0
+
+	// starvationEnergy is the energy below which development arrests and an
+	// L2 larva enters the dauer stage. dauerExitEnergy is the energy a dauer
+	// needs to resume development as an L4 larva.
+	starvationEnergy = 0.2
+	dauerExitEnergy  = 0.5
+
+	// hungerDrive and satietyDrive are how strongly hunger releases
+	// octopamine and a full gut releases serotonin, on top of the release by
+	// their source neurons.
+	hungerDrive  = 0.5
+	satietyDrive = 0.5
+
+	// driftLevel and driftHours are how far satiety or energy and the age
+	// may drift from the last saved state before it is saved again.
+	driftLevel = 0.05
+	driftHours = 1.0
+)
+
+// stageHours are the development hours at which each larval stage ends at
+// 20°C.
+var stageHours = []struct {
+	stage string
+	until float64
+}{
+	{stageL1, 16},
+	{stageL2, 28},
+	{stageL3, 38},
+	{stageL4, 50},
+}
+
+// lifecycle is the physiology of the worm besides its neurons.
+type lifecycle struct {
+	// AgeHours is the simulated time since the worm hatched.
+	AgeHours float64 `json:"age_hours"`
+	// DevelopmentHours is the part of the age the worm spent developing. It
+	// does not grow while the worm starves or is a dauer.
+	DevelopmentHours float64 `json:"development_hours"`
+	Stage            string  `json:"stage"`
+	// Satiety is how full the gut is and Energy how full the fat stores
+	// are, both between 0 and 1.
+	Satiety float64 `json:"satiety"`
+	Energy  float64 `json:"energy"`
+}
+
+// newLifecycle returns the lifecycle of a freshly hatched, well fed larva.
+func newLifecycle() lifecycle {
+	return lifecycle{Stage: stageL1, Satiety: 1, Energy: 1}
+}
+
+// drifted tells whether the lifecycle has aged or digested enough since the
+// saved one to be worth a save.
+func (l lifecycle) drifted(saved lifecycle) bool {
+	return math.Abs(l.Satiety-saved.Satiety) >= driftLevel ||
+		math.Abs(l.Energy-saved.Energy) >= driftLevel ||
+		l.AgeHours-saved.AgeHours >= driftHours
+}
+
+// adultLifecycle is the lifecycle given to states saved before the worm had
+// one, as Nema was always described as a grown worm.
+func adultLifecycle() lifecycle {
+	last := stageHours[len(stageHours)-1].until
+	return lifecycle{AgeHours: last, DevelopmentHours: last, Stage: stageAdult, Satiety: 1, Energy: 1}
+}
+
+// advance lets the given simulated time pass while the worm senses food of
+// the given concentration. The worm eats, digests, burns its energy and, as
+// long as it does not starve, develops.
+func (l *lifecycle) advance(d time.Duration, food float64) {
+	hours := d.Hours()
+	l.AgeHours += hours
+	l.eat(food, hours)
+	l.Satiety -= l.Satiety * hours / digestionHours
+	l.Energy += (l.Satiety - l.Energy) * hours / energyHours
+	l.Satiety = math.Min(math.Max(l.Satiety, 0), 1)
+	l.Energy = math.Min(math.Max(l.Energy, 0), 1)
+
+	switch {
+	case l.Stage == stageDauer:
+		// Dauers resume development as L4 larvae
+		if l.Energy >= dauerExitEnergy {
+			l.Stage = stageL4
+			l.DevelopmentHours = stageHours[2].until
+		}
+		return
+	case l.Energy < starvationEnergy:
+		if l.Stage == stageL2 {
+			l.Stage = stageDauer
+		}
+		return
+	}
+
+	l.DevelopmentHours += hours
+	l.Stage = stageAdult
+	for _, s := range stageHours {
+		if l.DevelopmentHours < s.until {
+			l.Stage = s.stage
+			break
+		}
+	}
+}
+
+// eat fills the gut from food of the given concentration for the given number
+// of hours. Dauers do not feed.
+func (l *lifecycle) eat(food, hours float64) {
+	if l.Stage == stageDauer {
+		return
+	}
+	l.Satiety += eatRate * food * (1 - l.Satiety) * hours
+	l.Satiety = math.Min(l.Satiety, 1)
+}
+
+// feed lets the worm eat from a food stimulus for its duration.
+func (l *lifecycle) feed(s Stimulus) {
+	if s.Type != "food" {
+		return
+	}
+	l.eat(s.Intensity, (time.Duration(s.Duration) * stepDuration).Hours())
+}
+
+// hunger is how empty the energy stores are, between 0 and 1.
+func (l *lifecycle) hunger() float64 {
+	return 1 - l.Energy
+}
+
+// describe returns a sentence about the worm's physiology for the LLM.
+func (l *lifecycle) describe() string {
+	feeling := "She is well fed"
+	switch {
+	case l.Energy < starvationEnergy:
+		feeling = "She is starving"
+	case l.hunger() > 0.5:
+		feeling = "She is hungry"
+	case l.Satiety < 0.3:
+		feeling = "She is a little peckish"
+	}
+	return fmt.Sprintf("Nema is %.1f hours old and at the %s stage. %s (satiety %.2f, energy %.2f).",
+		l.AgeHours, l.Stage, feeling, l.Satiety, l.Energy)
+}
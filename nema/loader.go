@@ -0,0 +1,148 @@
+package nema
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// bundledData holds the data files shipped with the service. They are used
+// whenever no path to a local data file is configured.
+//
+//go:embed data/*.csv
+var bundledData embed.FS
+
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+// readData reads the data file at path, or the bundled data file with the
+// given name when path is empty. It also returns the format of the file based
+// on its extension.
+func readData(path, bundled string) ([]byte, string, error) {
+	var data []byte
+	var err error
+	if path == "" {
+		path = bundled
+		data, err = bundledData.ReadFile("data/" + bundled)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv":
+		return data, formatCSV, nil
+	case ".json":
+		return data, formatJSON, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported data file extension %q for %s", ext, path)
+	}
+}
+
+var (
+	// muscleName matches body wall muscle names as written in the Cook et al.
+	// data, e.g. "dBWML1".
+	muscleName = regexp.MustCompile(`^([dv])BWM([LR])0*(\d+)$`)
+	// cordNeuronName matches the numbered ventral cord motor neurons, which
+	// some datasets write with a leading zero, e.g. "VA01".
+	cordNeuronName = regexp.MustCompile(`^(AS|DA|DB|DD|VA|VB|VC|VD)0*(\d+)$`)
+)
+
+// neuronKey converts a neuron name as it appears in a data file (e.g. "AVAL",
+// "VA01" or "dBWML1") to the key used in the state maps (e.g. "N_AVAL",
+// "N_VA1" or "N_MDL01").
+func neuronKey(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "N_")
+	if name == "" {
+		return ""
+	}
+
+	if m := muscleName.FindStringSubmatch(name); m != nil {
+		index, _ := strconv.Atoi(m[3])
+		return fmt.Sprintf("N_M%s%s%02d", strings.ToUpper(m[1]), m[2], index)
+	}
+	if m := cordNeuronName.FindStringSubmatch(name); m != nil {
+		return "N_" + m[1] + m[2]
+	}
+
+	return "N_" + name
+}
+
+// ValidateNetwork checks that the roster, the neuron registry, the connectome
+// and the neuron parameters agree with each other. It reports duplicate
+// neurons and synapses, synapses that are not attached to a neuron in the
+// roster, and metadata or parameters for unknown neurons. Every problem found
+// is returned, not only the first.
+func ValidateNetwork(r *roster, reg *registry, c *connectome, params map[string]NeuronParams) error {
+	var errs []error
+
+	known := make(map[string]bool, len(r.entries))
+	for _, entry := range r.entries {
+		if known[entry.Name] {
+			errs = append(errs, fmt.Errorf("duplicate neuron %s in roster", entry.Name))
+		}
+		known[entry.Name] = true
+	}
+
+	errs = append(errs, reg.validate(r, known)...)
+
+	checkEndpoints := func(kind string, s synapse) bool {
+		ok := true
+		for _, name := range []string{s.Pre, s.Post} {
+			switch {
+			case name == "":
+				errs = append(errs, fmt.Errorf("dangling %s synapse %q -> %q: missing neuron", kind, s.Pre, s.Post))
+				ok = false
+			case !known[name]:
+				errs = append(errs, fmt.Errorf("dangling %s synapse %s -> %s: %s is not in the roster", kind, s.Pre, s.Post, name))
+				ok = false
+			}
+		}
+		return ok
+	}
+
+	seen := make(map[[2]string]bool)
+	for _, s := range c.chemical {
+		if !checkEndpoints("chemical", s) {
+			continue
+		}
+		pair := [2]string{s.Pre, s.Post}
+		if seen[pair] {
+			errs = append(errs, fmt.Errorf("duplicate chemical synapse %s -> %s", s.Pre, s.Post))
+		}
+		seen[pair] = true
+	}
+
+	seen = make(map[[2]string]bool)
+	for _, s := range c.electrical {
+		if !checkEndpoints("electrical", s) {
+			continue
+		}
+		if s.Pre == s.Post {
+			errs = append(errs, fmt.Errorf("electrical synapse %s couples a neuron to itself", s.Pre))
+			continue
+		}
+		pair := [2]string{min(s.Pre, s.Post), max(s.Pre, s.Post)}
+		if seen[pair] {
+			errs = append(errs, fmt.Errorf("duplicate electrical synapse %s <-> %s", s.Pre, s.Post))
+		}
+		seen[pair] = true
+	}
+
+	for name := range params {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("parameters for unknown neuron %s", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -2,109 +2,363 @@ package nema
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tmc/langchaingo/llms"
 	"go.uber.org/zap"
 )
 
+// Config holds everything a Manager needs besides the logger and the database.
+type Config struct {
+	InitialPrompt string
+	LLM           llms.Model
+	Roster        *roster
+	Registry      *registry
+	Simulator     *simulator
+	// Clock is used for every timestamp saved with the worm. Defaults to the
+	// system clock.
+	Clock Clock
+	// Deterministic asks the LLM with a temperature of 0 and the Seed, so
+	// that together with a simulated clock and a seeded simulator runs with
+	// the same inputs produce the same states.
+	Deterministic bool
+	Seed          int
+	// Decay relaxes the neurons between interactions while RunDecay runs.
+	Decay DecayConfig
+	// Mode is how AskLLM changes the neurons, ModeDirect or ModeHybrid.
+	// Defaults to ModeDirect.
+	Mode string
+	// MaxRepairs is how many times an answer of the LLM that does not match
+	// the schema is sent back to be fixed before the prompt fails. Defaults
+	// to DefaultMaxRepairs. A negative value disables repairs.
+	MaxRepairs int
+	// Window keeps the conversation within a token budget.
+	Window WindowConfig
+}
+
 type Manager struct {
+	// mu serialises every interaction with the worm so the state is always
+	// updated sequentially.
+	mu            sync.Mutex
 	log           *zap.Logger
 	db            *dbm
 	state         neuro
 	initialPrompt string
 	llm           llms.Model
 	messages      []llms.MessageContent
+	sim           *simulator
+	registry      *registry
+	clock         Clock
+	llmOptions    []llms.CallOption
+	decay         DecayConfig
+	mode          string
+	maxRepairs    int
+	window        WindowConfig
+	// summary is the running summary of the turns compacted out of
+	// messages.
+	summary string
+	// decayed is set when the neurons have decayed since the state was last
+	// saved.
+	decayed bool
+	// saved is the lifecycle of the last saved state, so the decay loop can
+	// tell when the worm has aged or digested enough to be worth a save.
+	saved lifecycle
+	// savedLearning is what the worm had learned when the state was last
+	// saved, so only what changed since is written.
+	savedLearning learning
+	// lastCheckpoint is when the decayed state was last checked for a save.
+	// It is only used by the decay loop.
+	lastCheckpoint time.Time
 }
 
-func NewManager(log *zap.Logger, dbm *dbm, initialPrompt string, llm llms.Model) (*Manager, error) {
+func NewManager(log *zap.Logger, dbm *dbm, cfg Config) (*Manager, error) {
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock{}
+	}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ModeDirect
+	case ModeDirect, ModeHybrid:
+	default:
+		return nil, fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+	switch {
+	case cfg.MaxRepairs == 0:
+		cfg.MaxRepairs = DefaultMaxRepairs
+	case cfg.MaxRepairs < 0:
+		cfg.MaxRepairs = 0
+	}
 
 	// Get the initial state
 	nemaState, err := dbm.getState()
 	if err != nil {
 		if errors.Is(err, errNoState) {
 			log.Info("no state found, creating new nema")
-			nemaState = NewNeuro()
+			nemaState = NewNeuro(cfg.Roster, cfg.Clock)
 		} else {
 			return nil, fmt.Errorf("error getting nema: %w", err)
 		}
+	} else {
+		nemaState = nemaState.OnRoster(cfg.Roster)
 	}
 
-	// Build the initial prompt
-	initialPrompt = strings.Replace(initialPrompt, "%s", nemaState.JSONString(), 1)
+	// Restore what the worm has learned
+	nemaState.learning, err = dbm.getLearning()
+	if err != nil {
+		return nil, fmt.Errorf("error getting learning: %w", err)
+	}
+
+	// Restore the lesions of any running experiment
+	nemaState.lesions, err = dbm.getLesions()
+	if err != nil {
+		return nil, fmt.Errorf("error getting lesions: %w", err)
+	}
+	nemaState.holdLesions()
+
+	// Build the initial prompt. The state maps group the neurons in two
+	// buckets, so the real class of each neuron is described after it.
+	initialPrompt := strings.Replace(cfg.InitialPrompt, "%s", nemaState.JSONString(), 1)
+	initialPrompt += "\n\n" + cfg.Registry.describe()
+	if cfg.Mode == ModeDirect {
+		initialPrompt += "\n\nEvery answer must be a JSON object matching this JSON Schema:\n" + llmResponseSchema
+	}
 
 	messages := []llms.MessageContent{
 		llms.TextParts(llms.ChatMessageTypeHuman, initialPrompt),
 	}
 
+	// Pick the conversation up where it was left before the restart
+	summary, conversation, err := dbm.getConversation()
+	if err != nil {
+		return nil, fmt.Errorf("error getting conversation: %w", err)
+	}
+	messages = append(messages, conversation...)
+
+	llmOptions := []llms.CallOption{llms.WithTemperature(1)}
+	if cfg.Deterministic {
+		llmOptions = []llms.CallOption{llms.WithTemperature(0), llms.WithSeed(cfg.Seed)}
+	}
+
 	return &Manager{
 		log:           log,
 		db:            dbm,
 		state:         nemaState,
 		initialPrompt: initialPrompt,
-		llm:           llm,
+		llm:           cfg.LLM,
 		messages:      messages,
+		sim:           cfg.Simulator,
+		registry:      cfg.Registry,
+		clock:         cfg.Clock,
+		llmOptions:    llmOptions,
+		decay:         cfg.Decay,
+		mode:          cfg.Mode,
+		maxRepairs:    cfg.MaxRepairs,
+		window:        cfg.Window,
+		summary:       summary,
+		saved:         nemaState.Lifecycle,
+		savedLearning: nemaState.learning.clone(),
 	}, nil
 }
 
 func (m *Manager) GetState() neuro {
-	return m.state
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state.clone()
 }
 
-func (m *Manager) AskLLM(ctx context.Context, prompt string) (llmResponse, error) {
-	m.messages = append(m.messages, llms.TextParts(llms.ChatMessageTypeHuman, prompt))
+// Posture returns the body posture computed from the current muscle
+// activation.
+func (m *Manager) Posture() posture {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	completion, err := m.llm.GenerateContent(ctx, m.messages, llms.WithTemperature(1))
-	if err != nil {
-		return llmResponse{}, fmt.Errorf("error generating completion: %w", err)
+	return computePosture(&m.state)
+}
+
+// StateByClass returns the current neuron values grouped by neuron class.
+func (m *Manager) StateByClass() map[string]map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state.ByClass(m.registry)
+}
+
+// neuronState is the metadata of a neuron together with its current value.
+type neuronState struct {
+	neuronInfo
+	Value int `json:"value"`
+}
+
+// Neurons returns the metadata and current value of every neuron of the given
+// class. An empty class returns every neuron.
+func (m *Manager) Neurons(class string) []neuronState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var neurons []neuronState
+	for _, info := range m.registry.class(class) {
+		value, _ := m.state.value(info.Name)
+		neurons = append(neurons, neuronState{neuronInfo: info, Value: value})
 	}
+	return neurons
+}
 
-	response := completion.Choices[0].Content
+func (m *Manager) AskLLM(ctx context.Context, prompt string) (llmResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// Strip the response to only the JSON object. Everything before ```json and
-	// after ``` is removed.
-	response = strings.TrimPrefix(response, "```json\n")
-	response = strings.TrimSuffix(response, "\n```")
+	if m.mode == ModeHybrid {
+		return m.askHybrid(ctx, prompt)
+	}
 
-	m.messages = append(m.messages, llms.TextParts(llms.ChatMessageTypeAI, response))
+	human := llms.TextParts(llms.ChatMessageTypeHuman, prompt+"\n\n"+m.state.physiology())
+	m.fitWindow(ctx, human)
 
 	var lr llmResponse
-	if err = json.Unmarshal([]byte(response), &lr); err != nil {
-		return llmResponse{}, fmt.Errorf("error unmarshalling response: %w", err)
+	answer, err := m.ask(ctx, append(m.history(), human), func(response string) error {
+		var err error
+		lr, err = parseResponse(response, &m.state)
+		return err
+	})
+	if err != nil {
+		return llmResponse{}, err
+	}
+	lr.Reasoning = answer.Reasoning
+
+	// Only the prompt and the JSON object of the accepted answer join the
+	// conversation
+	if err := m.remember(human, llms.TextParts(llms.ChatMessageTypeAI, answer.JSON)); err != nil {
+		return llmResponse{}, err
 	}
 
 	// Update the neurons if the response indicates that they have changed
 	if lr.Changed {
 		m.log.Info("neurons changed, updating state")
+		wasAsleep := m.state.Sleep.Asleep
 		for _, neuron := range lr.MotorNeurons {
 			m.state.updateMotorNeuron(neuron.Neuron, neuron.Value)
 		}
+		// What the LLM makes her sense disturbs her like a stimulus of the
+		// same size
+		var change float64
 		for _, neuron := range lr.SensoryNeurons {
-			m.state.updateSensoryNeuron(neuron.Neuron, neuron.Value)
+			old, _ := m.state.value(neuron.Neuron)
+			if m.state.updateSensoryNeuron(neuron.Neuron, neuron.Value) {
+				change = math.Max(change, math.Abs(float64(neuron.Value-old)))
+			}
 		}
+		m.state.Sleep.disturb(&m.state, change)
+
+		// Let the activity propagate through the connectome so the motor
+		// output follows from the updated neurons
+		m.sim.Run(&m.state, stepsPerPrompt, nil)
+		m.trackSleep(wasAsleep)
 
 		// Update the state
-		id, err := m.db.saveState(m.state)
+		id, err := m.saveState()
 		if err != nil {
 			return llmResponse{}, fmt.Errorf("error updating state: %w", err)
 		}
 
 		// Save the prompt and response
-		if err := m.db.savePrompt(id, prompt, lr); err != nil {
+		if err := m.db.savePrompt(id, prompt, lr, m.clock.Now()); err != nil {
 			return llmResponse{}, fmt.Errorf("error saving prompt: %w", err)
 		}
 	} else {
 		m.log.Info("no neurons changed, skipping update")
 	}
 
+	lr.Behavior = classifyBehavior(&m.state)
+	lr.Asleep = m.state.Sleep.Asleep
+
 	m.log.Info("response", zap.Any("response", lr))
 
 	return lr, nil
 }
 
+// generate asks the LLM to continue the messages and returns its raw answer.
+func (m *Manager) generate(ctx context.Context, messages []llms.MessageContent) (string, error) {
+	completion, err := m.llm.GenerateContent(ctx, messages, m.llmOptions...)
+	if err != nil {
+		return "", fmt.Errorf("error generating completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("error generating completion: no choices")
+	}
+
+	return completion.Choices[0].Content, nil
+}
+
+// ApplyStimulus applies a typed stimulus to the sensory neurons for its
+// duration, lets the activity propagate to the muscles and saves the resulting
+// state together with the stimulus.
+func (m *Manager) ApplyStimulus(ctx context.Context, s Stimulus) (neuro, error) {
+	if err := s.validate(); err != nil {
+		return neuro{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stimulate([]Stimulus{s})
+
+	id, err := m.saveState()
+	if err != nil {
+		return neuro{}, fmt.Errorf("error updating state: %w", err)
+	}
+	if err := m.db.saveStimulus(id, s, m.clock.Now()); err != nil {
+		return neuro{}, fmt.Errorf("error saving stimulus: %w", err)
+	}
+
+	m.log.Info("stimulus applied", zap.Any("stimulus", s))
+
+	return m.state.clone(), nil
+}
+
+// stimulate applies the stimuli one after the other, lets the activity
+// propagate to the muscles and then lets the touch neurons habituate and the
+// worm eat any food it was given.
+func (m *Manager) stimulate(stimuli []Stimulus) {
+	wasAsleep := m.state.Sleep.Asleep
+	defer m.trackSleep(wasAsleep)
+
+	for _, s := range stimuli {
+		m.sim.Run(&m.state, s.Duration, s.input())
+	}
+	m.sim.Run(&m.state, stepsPerPrompt, nil)
+	for _, s := range stimuli {
+		m.sim.habituate(&m.state, s)
+		m.state.Lifecycle.feed(s)
+	}
+}
+
+// saveState counts the new state, classifies the worm's behavior and saves it
+// to the database. It returns the ID of the saved state.
+func (m *Manager) saveState() (int, error) {
+	m.state.StateCount++
+	m.state.UpdatedAt = m.clock.Now()
+	m.state.Behavior = classifyBehavior(&m.state)
+
+	id, err := m.db.saveState(m.state)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.db.saveLearning(id, m.state.learning, m.savedLearning); err != nil {
+		return 0, err
+	}
+	m.savedLearning = m.state.learning.clone()
+	m.decayed = false
+	m.saved = m.state.Lifecycle
+
+	return id, nil
+}
+
 type llmResponse struct {
 	HumanMessage string `json:"human_message"`
 	MotorNeurons []struct {
@@ -116,4 +370,14 @@ type llmResponse struct {
 		Value  int    `json:"value"`
 	} `json:"sensory_neurons"`
 	Changed bool `json:"changed"`
+	// Behavior is what the worm is doing after the prompt. It is not part of
+	// the LLM's answer.
+	Behavior behavior `json:"-"`
+	// Stimuli are the stimuli the prompt was interpreted as in hybrid mode.
+	Stimuli []Stimulus `json:"-"`
+	// Asleep tells whether the worm is sleeping after the prompt.
+	Asleep bool `json:"-"`
+	// Reasoning is what a reasoning model thought before answering. It is
+	// saved with the prompt for debugging.
+	Reasoning string `json:"-"`
 }
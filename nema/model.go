@@ -0,0 +1,199 @@
+package nema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// NeuronParams are the per-neuron parameters used by a NeuronModel.
+type NeuronParams struct {
+	// Resting is the value the neuron relaxes towards without input.
+	Resting float64 `json:"resting"`
+	// TimeConstant is the number of steps over which the neuron leaks back to
+	// its resting value. It must be at least 1.
+	TimeConstant float64 `json:"time_constant"`
+	// Threshold is the value above which the neuron releases transmitter.
+	Threshold float64 `json:"threshold"`
+}
+
+// defaultNeuronParams are used for every neuron without explicit parameters.
+var defaultNeuronParams = NeuronParams{
+	Resting:      0,
+	TimeConstant: 10,
+	Threshold:    0,
+}
+
+// NeuronModel describes the dynamics of a single neuron. Values are in the
+// same [-128, 127] range as the neuro state.
+type NeuronModel interface {
+	// Name returns the name used to select the model in the config.
+	Name() string
+	// Update returns the next value of a neuron given its current value and
+	// the total synaptic input it receives during the step.
+	Update(p NeuronParams, value, input float64) float64
+	// Output returns the activity a neuron with the given value transmits
+	// across its chemical synapses.
+	Output(p NeuronParams, value float64) float64
+}
+
+// NewNeuronModel returns the neuron model with the given name. An empty name
+// selects the threshold model.
+func NewNeuronModel(name string) (NeuronModel, error) {
+	switch name {
+	case "leaky":
+		return leakyModel{}, nil
+	case "threshold", "":
+		return thresholdModel{}, nil
+	case "graded":
+		return gradedModel{}, nil
+	default:
+		return nil, fmt.Errorf("unknown neuron model %q", name)
+	}
+}
+
+// leak moves the value towards rest according to the time constant and adds
+// the input.
+func leak(p NeuronParams, value, input float64) float64 {
+	tau := math.Max(p.TimeConstant, 1)
+	return value + (p.Resting-value)/tau + input
+}
+
+// leakyModel is a linear leaky integrator. Its output is its displacement
+// from rest, so a hyperpolarised neuron reduces the activity of the neurons it
+// excites.
+type leakyModel struct{}
+
+func (leakyModel) Name() string { return "leaky" }
+
+func (leakyModel) Update(p NeuronParams, value, input float64) float64 {
+	return leak(p, value, input)
+}
+
+func (leakyModel) Output(p NeuronParams, value float64) float64 {
+	return value - p.Resting
+}
+
+// thresholdModel is a leaky integrator with a rectified output. The neuron
+// only transmits the part of its value above the threshold.
+type thresholdModel struct{}
+
+func (thresholdModel) Name() string { return "threshold" }
+
+func (thresholdModel) Update(p NeuronParams, value, input float64) float64 {
+	return leak(p, value, input)
+}
+
+func (thresholdModel) Output(p NeuronParams, value float64) float64 {
+	return math.Max(value-p.Threshold, 0)
+}
+
+// gradedSlope controls how sharply the graded model's release saturates
+// around the threshold.
+const gradedSlope = 16
+
+// gradedModel is a leaky integrator with graded, sigmoidal transmitter
+// release, as seen in most C. elegans neurons which do not fire action
+// potentials.
+type gradedModel struct{}
+
+func (gradedModel) Name() string { return "graded" }
+
+func (gradedModel) Update(p NeuronParams, value, input float64) float64 {
+	return leak(p, value, input)
+}
+
+func (gradedModel) Output(p NeuronParams, value float64) float64 {
+	return 127 / (1 + math.Exp(-(value-p.Threshold)/gradedSlope))
+}
+
+// LoadNeuronParams loads per-neuron parameters from a local CSV or JSON file.
+// The parameters bundled with the service are used when path is empty.
+// Neurons that are not listed use defaultNeuronParams.
+//
+// CSV files use the name,resting,time_constant,threshold layout. JSON files
+// contain an object keyed by neuron name.
+func LoadNeuronParams(path string) (map[string]NeuronParams, error) {
+	data, format, err := readData(path, "neuron_params.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	var params map[string]NeuronParams
+	switch format {
+	case formatCSV:
+		params, err = parseNeuronParamsCSV(bytes.NewReader(data))
+	case formatJSON:
+		params, err = parseNeuronParamsJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing neuron params: %w", err)
+	}
+
+	return params, nil
+}
+
+func parseNeuronParamsJSON(data []byte) (map[string]NeuronParams, error) {
+	var raw map[string]NeuronParams
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]NeuronParams, len(raw))
+	for name, p := range raw {
+		if p.TimeConstant < 1 {
+			return nil, fmt.Errorf("time constant for %s must be at least 1", name)
+		}
+		params[neuronKey(name)] = p
+	}
+
+	return params, nil
+}
+
+// parseNeuronParamsCSV reads neuron parameters in the
+// name,resting,time_constant,threshold layout.
+func parseNeuronParamsCSV(r io.Reader) (map[string]NeuronParams, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	// Skip the header
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+
+	params := make(map[string]NeuronParams)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %w", err)
+		}
+
+		var values [3]float64
+		for i := range values {
+			values[i], err = strconv.ParseFloat(record[i+1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s: %w", record[i+1], record[0], err)
+			}
+		}
+		if values[1] < 1 {
+			return nil, fmt.Errorf("time constant for %s must be at least 1", record[0])
+		}
+
+		params[neuronKey(record[0])] = NeuronParams{
+			Resting:      values[0],
+			TimeConstant: values[1],
+			Threshold:    values[2],
+		}
+	}
+
+	return params, nil
+}
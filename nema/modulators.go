@@ -0,0 +1,116 @@
+package nema
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// modulatorRelease is the increase of a modulator level per step when its
+	// releasing neurons are fully depolarised. With the release matching the
+	// clearance, a sustained level follows the activity of the source neurons.
+	modulatorRelease = 1.0 / modulatorTimeConstant
+	// modulatorTimeConstant is the number of steps over which a modulator is
+	// cleared without release.
+	modulatorTimeConstant = 50
+)
+
+// modulators are the global levels of the neuromodulators, each between 0 and
+// 1. Unlike synaptic transmission they act on many neurons at once and set the
+// behavioral state of the worm, e.g. dwelling on food or roaming.
+type modulators struct {
+	Serotonin  float64 `json:"serotonin"`
+	Dopamine   float64 `json:"dopamine"`
+	Octopamine float64 `json:"octopamine"`
+	Tyramine   float64 `json:"tyramine"`
+}
+
+// modulatorSources are the neurons releasing each modulator.
+var modulatorSources = struct {
+	serotonin, dopamine, octopamine, tyramine []string
+}{
+	serotonin:  []string{"N_NSML", "N_NSMR"},
+	dopamine:   []string{"N_CEPDL", "N_CEPDR", "N_CEPVL", "N_CEPVR", "N_ADEL", "N_ADER", "N_PDEL", "N_PDER"},
+	octopamine: []string{"N_RICL", "N_RICR"},
+	tyramine:   []string{"N_RIML", "N_RIMR"},
+}
+
+// update releases each modulator according to the activity of its source
+// neurons and clears part of what was released before. A full gut releases
+// more serotonin and hunger more octopamine.
+func (m *modulators) update(n *neuro) {
+	step := func(level, release float64) float64 {
+		level += modulatorRelease*math.Min(release, 1) - level/modulatorTimeConstant
+		return math.Min(math.Max(level, 0), 1)
+	}
+
+	m.Serotonin = step(m.Serotonin, activity(n, modulatorSources.serotonin...)+satietyDrive*n.Lifecycle.Satiety)
+	m.Dopamine = step(m.Dopamine, activity(n, modulatorSources.dopamine...))
+	m.Octopamine = step(m.Octopamine, activity(n, modulatorSources.octopamine...)+hungerDrive*n.Lifecycle.hunger())
+	m.Tyramine = step(m.Tyramine, activity(n, modulatorSources.tyramine...))
+}
+
+// Groups of neurons targeted by the modulators, matched by name prefix.
+var (
+	forwardNeurons    = []string{"N_AVB", "N_VB", "N_DB"}
+	backwardNeurons   = []string{"N_AVA", "N_VA", "N_DA"}
+	headMotorNeurons  = []string{"N_RMD", "N_SMD", "N_SMB"}
+	pharyngealNeurons = []string{"N_M1", "N_M2", "N_M3", "N_M4", "N_M5", "N_MC", "N_MI", "N_I1", "N_I2", "N_I3", "N_I4", "N_I5", "N_I6"}
+)
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// modulatorTarget is the group of neurons a neuron belongs to as far as the
+// modulators are concerned.
+type modulatorTarget int
+
+const (
+	targetNone modulatorTarget = iota
+	targetForward
+	targetBackward
+	targetHeadMotor
+	targetPharyngeal
+)
+
+// targetOf returns the modulator target of a neuron.
+func targetOf(neuron string) modulatorTarget {
+	switch {
+	case hasAnyPrefix(neuron, forwardNeurons):
+		return targetForward
+	case hasAnyPrefix(neuron, backwardNeurons):
+		return targetBackward
+	case hasAnyPrefix(neuron, headMotorNeurons):
+		return targetHeadMotor
+	case hasAnyPrefix(neuron, pharyngealNeurons):
+		return targetPharyngeal
+	}
+	return targetNone
+}
+
+// gain returns the factor the modulators apply to the synaptic input of the
+// neurons of a target.
+//
+//   - Serotonin and dopamine slow locomotion on food, and serotonin speeds up
+//     pharyngeal pumping.
+//   - Octopamine signals starvation. It promotes roaming and slows pumping.
+//   - Tyramine promotes reversals and suppresses head oscillations.
+func (m modulators) gain(t modulatorTarget) float64 {
+	switch t {
+	case targetForward:
+		return (1 - 0.4*m.Serotonin) * (1 - 0.3*m.Dopamine) * (1 + 0.3*m.Octopamine)
+	case targetBackward:
+		return (1 - 0.3*m.Dopamine) * (1 + 0.3*m.Tyramine)
+	case targetHeadMotor:
+		return 1 - 0.5*m.Tyramine
+	case targetPharyngeal:
+		return (1 + 0.5*m.Serotonin) * (1 - 0.3*m.Octopamine)
+	}
+	return 1
+}
@@ -0,0 +1,55 @@
+package nema
+
+// network is the connectome together with the neuron parameters laid out for
+// a neuron index, so a step can address every neuron by its position in the
+// dense state instead of its name.
+type network struct {
+	chemical   []indexedSynapse
+	electrical []indexedSynapse
+	params     []NeuronParams
+	targets    []modulatorTarget
+}
+
+// indexedSynapse is a synapse between the neurons at two positions of the
+// dense state.
+type indexedSynapse struct {
+	pre, post int
+	weight    float64
+	// key identifies the synapse in what the worm has learned
+	key synapseKey
+}
+
+// newNetwork lays out the simulator's connectome and parameters for the given
+// index. Synapses of neurons that are not in the index are left out.
+func newNetwork(s *simulator, x *neuronIndex) *network {
+	net := &network{
+		params:  make([]NeuronParams, x.len()),
+		targets: make([]modulatorTarget, x.len()),
+	}
+	for i, name := range x.names {
+		net.params[i] = s.neuronParams(name)
+		net.targets[i] = targetOf(name)
+	}
+
+	indexed := func(synapses []synapse) []indexedSynapse {
+		var out []indexedSynapse
+		for _, syn := range synapses {
+			pre, okPre := x.position(syn.Pre)
+			post, okPost := x.position(syn.Post)
+			if !okPre || !okPost {
+				continue
+			}
+			out = append(out, indexedSynapse{
+				pre:    pre,
+				post:   post,
+				weight: syn.Weight,
+				key:    synapseKey{Pre: syn.Pre, Post: syn.Post},
+			})
+		}
+		return out
+	}
+	net.chemical = indexed(s.connectome.chemical)
+	net.electrical = indexed(s.connectome.electrical)
+
+	return net
+}
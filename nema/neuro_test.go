@@ -0,0 +1,41 @@
+package nema
+
+import "testing"
+
+func TestOnRoster(t *testing.T) {
+	r, err := LoadRoster("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A state saved with an older roster that lacked most neurons and had
+	// one that is gone now
+	saved := neuroFromMaps(
+		map[string]int{"N_MDL01": 5},
+		map[string]int{"N_ASHL": -3, "N_GONE": 9},
+	)
+	n := saved.OnRoster(r)
+
+	if n.index != r.index {
+		t.Fatal("state is not on the roster index")
+	}
+	for name, want := range map[string]int{"N_MDL01": 5, "N_ASHL": -3} {
+		if got, _ := n.value(name); got != want {
+			t.Errorf("got %s %d, want the saved %d", name, got, want)
+		}
+	}
+	if _, ok := n.value("N_GONE"); ok {
+		t.Error("neuron missing from the roster was kept")
+	}
+	for _, entry := range r.entries {
+		if entry.Name == "N_MDL01" || entry.Name == "N_ASHL" {
+			continue
+		}
+		if got, _ := n.value(entry.Name); got != entry.Initial {
+			t.Errorf("got %s %d, want the initial %d", entry.Name, got, entry.Initial)
+		}
+	}
+	if !n.updateSensoryNeuron("N_ASHR", 40) {
+		t.Error("neuron missing from the saved state cannot be set")
+	}
+}
@@ -0,0 +1,121 @@
+package nema
+
+import (
+	"maps"
+	"math"
+)
+
+// PlasticityConfig holds the learning rates of the plasticity layer. A rate of
+// zero disables that kind of learning.
+type PlasticityConfig struct {
+	// HebbianRate is the change of a synapse's weight factor per step when
+	// both neurons are fully active.
+	HebbianRate float64
+	// HabituationRate is the fraction of the remaining response a touch
+	// neuron loses every time it is stimulated.
+	HabituationRate float64
+	// RecoveryRate is the fraction of its habituation a touch neuron recovers
+	// per step.
+	RecoveryRate float64
+}
+
+// DefaultPlasticityConfig are the learning rates used when none are
+// configured. Habituation builds up over a handful of taps and recovers over
+// a few hundred steps, while synapses change over days of interaction.
+var DefaultPlasticityConfig = PlasticityConfig{
+	HebbianRate:     0.001,
+	HabituationRate: 0.2,
+	RecoveryRate:    0.005,
+}
+
+const (
+	// hebbianThreshold is the postsynaptic activity below which an active
+	// presynaptic neuron weakens its synapse instead of strengthening it.
+	hebbianThreshold = 0.2
+	// minWeightFactor and maxWeightFactor bound how far learning can scale a
+	// synapse from its weight in the connectome.
+	minWeightFactor = 0.5
+	maxWeightFactor = 2
+)
+
+// mechanosensoryStimuli are the stimuli the touch neurons habituate to.
+var mechanosensoryStimuli = map[string]bool{
+	"tap":             true,
+	"anterior_touch":  true,
+	"posterior_touch": true,
+	"nose_touch":      true,
+}
+
+// synapseKey identifies a chemical synapse by its pre and postsynaptic
+// neurons.
+type synapseKey struct {
+	Pre, Post string
+}
+
+// learning is what a worm has learned. It is persisted in its own tables
+// rather than with each neural state.
+type learning struct {
+	// weights are the factors applied to the connectome weight of chemical
+	// synapses. Synapses that are not listed have a factor of 1.
+	weights map[synapseKey]float64
+	// habituation is the fraction of their response touch neurons have lost
+	// to repeated stimulation, between 0 and 1.
+	habituation map[string]float64
+}
+
+// clone returns a copy of the learning that does not share its maps.
+func (l *learning) clone() learning {
+	return learning{weights: maps.Clone(l.weights), habituation: maps.Clone(l.habituation)}
+}
+
+// weight returns the learned factor of a synapse.
+func (l *learning) weight(k synapseKey) float64 {
+	if f, ok := l.weights[k]; ok {
+		return f
+	}
+	return 1
+}
+
+// hebbian changes the weight factor of a synapse according to the activity of
+// its neurons, between 0 and 1. Synapses whose neurons are active together
+// are strengthened and synapses whose presynaptic neuron fails to activate
+// the postsynaptic neuron are weakened.
+func (l *learning) hebbian(k synapseKey, rate, pre, post float64) {
+	if rate == 0 || pre == 0 {
+		return
+	}
+	if l.weights == nil {
+		l.weights = make(map[synapseKey]float64)
+	}
+	f := l.weight(k) + rate*pre*(post-hebbianThreshold)
+	l.weights[k] = math.Min(math.Max(f, minWeightFactor), maxWeightFactor)
+}
+
+// habituate makes the given neurons lose part of their remaining response.
+func (l *learning) habituate(neurons []string, rate float64) {
+	if l.habituation == nil {
+		l.habituation = make(map[string]float64)
+	}
+	for _, name := range neurons {
+		h := l.habituation[name]
+		l.habituation[name] = h + rate*(1-h)
+	}
+}
+
+// recoverHabituation lets every habituated neuron regain part of its
+// response.
+func (l *learning) recoverHabituation(rate float64) {
+	for name, h := range l.habituation {
+		h -= rate * h
+		if h < 1e-3 {
+			delete(l.habituation, name)
+			continue
+		}
+		l.habituation[name] = h
+	}
+}
+
+// response returns the fraction of its response a neuron still has.
+func (l *learning) response(neuron string) float64 {
+	return 1 - l.habituation[neuron]
+}
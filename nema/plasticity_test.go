@@ -0,0 +1,83 @@
+package nema
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestSaveLearning(t *testing.T) {
+	m := newTestManager(t, &scriptedLLM{}, 0)
+	ava := synapseKey{Pre: "N_AVAL", Post: "N_AVAR"}
+	avb := synapseKey{Pre: "N_AVBL", Post: "N_AVBR"}
+
+	steps := []struct {
+		name        string
+		weights     map[synapseKey]float64
+		habituation map[string]float64
+	}{
+		{name: "nothing learned"},
+		{
+			name:        "first learning",
+			weights:     map[synapseKey]float64{ava: 1.2, avb: 0.8},
+			habituation: map[string]float64{"N_ALML": 0.3, "N_ALMR": 0.3},
+		},
+		{
+			name:        "one weight and level changed",
+			weights:     map[synapseKey]float64{ava: 1.3, avb: 0.8},
+			habituation: map[string]float64{"N_ALML": 0.2, "N_ALMR": 0.3},
+		},
+		{
+			name:        "recovered level removed",
+			weights:     map[synapseKey]float64{ava: 1.3, avb: 0.8},
+			habituation: map[string]float64{"N_ALMR": 0.3},
+		},
+		{name: "everything forgotten"},
+	}
+
+	// savedWith is the state each row of avb was last written with
+	savedWith := func() int {
+		var id int
+		q := `SELECT neural_state_id FROM synapse_weights WHERE worm_id = ? AND pre = ? AND post = ?`
+		if err := m.db.db.QueryRow(q, m.db.wormID, avb.Pre, avb.Post).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	var firstID int
+	for i, step := range steps {
+		m.state.learning = learning{weights: maps.Clone(step.weights), habituation: maps.Clone(step.habituation)}
+		id, err := m.saveState()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		// Unchanged rows are not written again
+		switch i {
+		case 1:
+			firstID = id
+		case 2, 3:
+			if got := savedWith(); got != firstID {
+				t.Errorf("%s: unchanged weight saved with state %d, want %d", step.name, got, firstID)
+			}
+		}
+
+		got, err := m.db.getLearning()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.weights) != len(step.weights) || len(got.habituation) != len(step.habituation) {
+			t.Fatalf("%s: got %v and %v, want %v and %v", step.name, got.weights, got.habituation, step.weights, step.habituation)
+		}
+		for k, f := range step.weights {
+			if got.weights[k] != f {
+				t.Errorf("%s: got weight %v of %v, want %v", step.name, got.weights[k], k, f)
+			}
+		}
+		for neuron, h := range step.habituation {
+			if got.habituation[neuron] != h {
+				t.Errorf("%s: got habituation %v of %s, want %v", step.name, got.habituation[neuron], neuron, h)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package nema
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// bodySegments is the number of body wall muscle rows along the body.
+	bodySegments = 24
+	// maxSegmentBend is the bend in radians of a segment whose dorsal muscles
+	// are fully contracted and whose ventral muscles are fully relaxed, or
+	// the other way around.
+	maxSegmentBend = math.Pi / 12
+	// straightCurvature is the mean absolute bend in radians per segment
+	// below which the worm is considered straight.
+	straightCurvature = 0.02
+)
+
+// segment is the muscle activation and shape of a single body segment.
+type segment struct {
+	Index int `json:"index"`
+	// Dorsal and Ventral are the mean activation of the left and right
+	// muscles on each side, from 0 (relaxed) to 1 (fully contracted).
+	Dorsal  float64 `json:"dorsal"`
+	Ventral float64 `json:"ventral"`
+	// Curvature is the bend of the segment in radians. Positive values bend
+	// the body dorsally.
+	Curvature float64 `json:"curvature"`
+	// Angle is the direction of the segment in radians relative to the head.
+	Angle float64 `json:"angle"`
+	// X and Y are the position of the end of the segment with the head at the
+	// origin, in body lengths.
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// posture is the 2D midline of the worm computed from the body wall muscles.
+type posture struct {
+	Segments []segment `json:"segments"`
+	// Summary is a short description of the posture, e.g. "straight".
+	Summary string `json:"summary"`
+}
+
+// muscleActivation returns the activation of a body wall muscle between 0 and
+// 1. Muscles only contract when depolarised.
+func muscleActivation(n *neuro, muscle string) (float64, bool) {
+	value, ok := n.value(muscle)
+	if !ok {
+		return 0, false
+	}
+	return math.Max(float64(value), 0) / 127, true
+}
+
+// muscleNames are the keys of the left and right body wall muscles of each
+// side and segment, e.g. "N_MDL01" and "N_MDR01" for side "MD" and segment 1.
+// They are built once as the posture is computed on every step.
+var muscleNames = func() map[string][][2]string {
+	names := make(map[string][][2]string)
+	for _, side := range []string{"MD", "MV"} {
+		names[side] = make([][2]string, bodySegments+1)
+		for i := 1; i <= bodySegments; i++ {
+			names[side][i] = [2]string{
+				fmt.Sprintf("N_%sL%02d", side, i),
+				fmt.Sprintf("N_%sR%02d", side, i),
+			}
+		}
+	}
+	return names
+}()
+
+// sideActivation returns the mean activation of the left and right muscles of
+// one side of a segment, e.g. side "MD" for the dorsal muscles.
+func sideActivation(n *neuro, side string, index int) float64 {
+	var sum float64
+	var count int
+	for _, muscle := range muscleNames[side][index] {
+		if a, ok := muscleActivation(n, muscle); ok {
+			sum += a
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// computePosture maps the body wall muscles to dorsal and ventral activation
+// per segment and integrates the resulting bends into a midline, from the head
+// to the tail.
+func computePosture(n *neuro) posture {
+	p := posture{Segments: make([]segment, 0, bodySegments)}
+
+	var angle, x, y, totalBend float64
+	var signChanges int
+	length := 1.0 / bodySegments
+	for i := 1; i <= bodySegments; i++ {
+		s := segment{
+			Index:   i,
+			Dorsal:  sideActivation(n, "MD", i),
+			Ventral: sideActivation(n, "MV", i),
+		}
+		s.Curvature = maxSegmentBend * (s.Dorsal - s.Ventral)
+
+		if len(p.Segments) > 0 {
+			prev := p.Segments[len(p.Segments)-1].Curvature
+			if prev*s.Curvature < 0 {
+				signChanges++
+			}
+		}
+
+		angle += s.Curvature
+		x += length * math.Cos(angle)
+		y += length * math.Sin(angle)
+		s.Angle = angle
+		s.X = x
+		s.Y = y
+
+		totalBend += s.Curvature
+		p.Segments = append(p.Segments, s)
+	}
+
+	p.Summary = describePosture(p.Segments, totalBend, signChanges)
+
+	return p
+}
+
+func describePosture(segments []segment, totalBend float64, signChanges int) string {
+	var meanBend float64
+	for _, s := range segments {
+		meanBend += math.Abs(s.Curvature)
+	}
+	meanBend /= float64(len(segments))
+
+	switch {
+	case meanBend < straightCurvature:
+		return "straight"
+	case signChanges >= 2:
+		return "sinusoidal"
+	case signChanges == 1:
+		return "S-shaped"
+	case totalBend > 0:
+		return "bent dorsally"
+	default:
+		return "bent ventrally"
+	}
+}
@@ -0,0 +1,226 @@
+package nema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+	"go.uber.org/zap"
+)
+
+// Provider types
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai"
+	// ProviderOpenAICompatible is any server speaking the OpenAI API at its
+	// own base URL, e.g. a llama.cpp server or vLLM.
+	ProviderOpenAICompatible = "openai_compatible"
+	ProviderMock             = "mock"
+)
+
+// DefaultProviderTimeout is how long a provider may take to answer before the
+// next one in the fallback chain is asked.
+const DefaultProviderTimeout = 2 * time.Minute
+
+// ProviderConfig is a named LLM backend.
+type ProviderConfig struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Model   string `json:"model,omitempty"`
+	BaseURL string `json:"base_url,omitempty"`
+	// APIKeyEnv is the env var holding the API key, so keys stay out of the
+	// file. The openai type defaults to OPENAI_API_KEY.
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+	// Timeout is a duration like "90s". Defaults to DefaultProviderTimeout.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ProvidersConfig holds the LLM backends and the order they are asked in.
+type ProvidersConfig struct {
+	Providers []ProviderConfig `json:"providers"`
+	// Fallback lists provider names, primary first. Each is asked when the
+	// ones before it fail or time out.
+	Fallback []string `json:"fallback"`
+}
+
+// LoadProviders loads the provider registry from a JSON file and builds its
+// fallback chain.
+func LoadProviders(log *zap.Logger, path string, mockLLM llms.Model) (llms.Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var cfg ProvidersConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("error parsing providers: %w", err)
+	}
+
+	return NewProviders(log, cfg, mockLLM)
+}
+
+// NewProviders builds the fallback chain of the providers. Unknown provider
+// types and names fail instead of silently falling back to another backend.
+// Providers of the mock type answer with mockLLM, which the caller supplies so
+// the mock stays out of this package.
+func NewProviders(log *zap.Logger, cfg ProvidersConfig, mockLLM llms.Model) (llms.Model, error) {
+	byName := make(map[string]ProviderConfig, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		if p.Name == "" {
+			return nil, errors.New("provider without a name")
+		}
+		if _, ok := byName[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate provider %q", p.Name)
+		}
+		switch p.Type {
+		case ProviderOllama, ProviderOpenAI, ProviderOpenAICompatible:
+		case ProviderMock:
+			if mockLLM == nil {
+				return nil, fmt.Errorf("no mock LLM for provider %s", p.Name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown type %q of provider %s", p.Type, p.Name)
+		}
+		byName[p.Name] = p
+	}
+	if len(cfg.Fallback) == 0 {
+		return nil, errors.New("no providers in the fallback chain")
+	}
+
+	chain := &fallbackLLM{log: log}
+	for _, name := range cfg.Fallback {
+		p, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown provider %q in the fallback chain", name)
+		}
+		llm, err := newProvider(p, mockLLM)
+		if err != nil {
+			return nil, fmt.Errorf("error creating provider %s: %w", p.Name, err)
+		}
+
+		timeout := DefaultProviderTimeout
+		if p.Timeout != "" {
+			timeout, err = time.ParseDuration(p.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid timeout %q of provider %s", p.Timeout, p.Name)
+			}
+		}
+
+		log.Info("llm provider created", zap.String("name", p.Name), zap.String("type", p.Type), zap.String("model", p.Model))
+		chain.providers = append(chain.providers, provider{name: p.Name, llm: llm, timeout: timeout})
+	}
+
+	return chain, nil
+}
+
+// newProvider creates the client of a provider.
+func newProvider(p ProviderConfig, mockLLM llms.Model) (llms.Model, error) {
+	switch p.Type {
+	case ProviderOllama:
+		opts := []ollama.Option{ollama.WithModel(p.Model)}
+		if p.BaseURL != "" {
+			opts = append(opts, ollama.WithServerURL(p.BaseURL))
+		}
+		return ollama.New(opts...)
+	case ProviderOpenAI, ProviderOpenAICompatible:
+		// The client falls back to the OPENAI_ env vars for every option it
+		// is not given, so a compatible server gets all of them explicitly
+		// and never sees the OpenAI key, URL or model.
+		var opts []openai.Option
+		if p.Type == ProviderOpenAICompatible {
+			if p.BaseURL == "" {
+				return nil, errors.New("base_url is required")
+			}
+			opts = append(opts, openai.WithModel(p.Model), openai.WithBaseURL(p.BaseURL), openai.WithOrganization(""))
+		} else {
+			if p.Model != "" {
+				opts = append(opts, openai.WithModel(p.Model))
+			}
+			if p.BaseURL != "" {
+				opts = append(opts, openai.WithBaseURL(p.BaseURL))
+			}
+		}
+
+		key, err := apiKey(p)
+		if err != nil {
+			return nil, err
+		}
+		return openai.New(append(opts, openai.WithToken(key))...)
+	case ProviderMock:
+		return mockLLM, nil
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", p.Type)
+	}
+}
+
+// apiKey returns the API key of a provider from its env var. The openai type
+// defaults to OPENAI_API_KEY. A compatible server without a key env var gets
+// a placeholder, as local servers like llama.cpp ignore the key but the
+// client requires one.
+func apiKey(p ProviderConfig) (string, error) {
+	keyEnv := p.APIKeyEnv
+	if keyEnv == "" {
+		if p.Type == ProviderOpenAICompatible {
+			return "none", nil
+		}
+		keyEnv = "OPENAI_API_KEY"
+	}
+	key := os.Getenv(keyEnv)
+	if key == "" {
+		return "", fmt.Errorf("api key env var %s is not set", keyEnv)
+	}
+	return key, nil
+}
+
+// provider is an LLM of the fallback chain.
+type provider struct {
+	name    string
+	llm     llms.Model
+	timeout time.Duration
+}
+
+// fallbackLLM asks its providers in order until one answers.
+type fallbackLLM struct {
+	log       *zap.Logger
+	providers []provider
+}
+
+// GenerateContent asks each provider in turn, giving each its own timeout,
+// and returns the first answer. It stops early when ctx is done.
+func (f *fallbackLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var errs []error
+	for i, p := range f.providers {
+		pctx, cancel := context.WithTimeout(ctx, p.timeout)
+		resp, err := p.llm.GenerateContent(pctx, messages, options...)
+		cancel()
+		if err == nil {
+			if i > 0 {
+				f.log.Info("llm fallback answered", zap.String("provider", p.name))
+			}
+			return resp, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(f.providers)-1 {
+			f.log.Warn("llm provider failed, falling back", zap.String("provider", p.name), zap.Error(err))
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Call asks the chain with a single prompt.
+func (f *fallbackLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, f, prompt, options...)
+}
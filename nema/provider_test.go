@@ -0,0 +1,67 @@
+package nema
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewProviders(t *testing.T) {
+	t.Setenv("NEMA_TEST_KEY", "secret")
+	t.Setenv("NEMA_TEST_EMPTY_KEY", "")
+
+	tests := []struct {
+		name     string
+		provider ProviderConfig
+		err      string
+	}{
+		{
+			name:     "mock",
+			provider: ProviderConfig{Name: "p", Type: ProviderMock},
+		},
+		{
+			name:     "compatible without key",
+			provider: ProviderConfig{Name: "p", Type: ProviderOpenAICompatible, BaseURL: "http://localhost:8080/v1"},
+		},
+		{
+			name:     "compatible with key",
+			provider: ProviderConfig{Name: "p", Type: ProviderOpenAICompatible, BaseURL: "http://localhost:8080/v1", APIKeyEnv: "NEMA_TEST_KEY"},
+		},
+		{
+			name:     "compatible with an empty key env var",
+			provider: ProviderConfig{Name: "p", Type: ProviderOpenAICompatible, BaseURL: "http://localhost:8080/v1", APIKeyEnv: "NEMA_TEST_EMPTY_KEY"},
+			err:      "NEMA_TEST_EMPTY_KEY is not set",
+		},
+		{
+			name:     "compatible without base url",
+			provider: ProviderConfig{Name: "p", Type: ProviderOpenAICompatible},
+			err:      "base_url is required",
+		},
+		{
+			name:     "openai with an unset key env var",
+			provider: ProviderConfig{Name: "p", Type: ProviderOpenAI, APIKeyEnv: "NEMA_TEST_UNSET_KEY"},
+			err:      "NEMA_TEST_UNSET_KEY is not set",
+		},
+		{
+			name:     "unknown type",
+			provider: ProviderConfig{Name: "p", Type: "gemini"},
+			err:      `unknown type "gemini"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProviders(zap.NewNop(), ProvidersConfig{
+				Providers: []ProviderConfig{tt.provider},
+				Fallback:  []string{tt.provider.Name},
+			}, &scriptedLLM{})
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("got error %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
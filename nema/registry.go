@@ -0,0 +1,201 @@
+package nema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Neuron classes. Body wall, anal and vulval muscles are kept in the state
+// alongside the neurons and have their own class.
+const (
+	classSensory     = "sensory"
+	classInterneuron = "interneuron"
+	classMotor       = "motor"
+	classPharyngeal  = "pharyngeal"
+	classMuscle      = "muscle"
+)
+
+var neuronClasses = []string{classSensory, classInterneuron, classMotor, classPharyngeal, classMuscle}
+
+// neuronInfo is the anatomical and chemical description of a single neuron.
+type neuronInfo struct {
+	Name             string `json:"name"`
+	Class            string `json:"class"`
+	Neurotransmitter string `json:"neurotransmitter"`
+	// Partner is the bilateral partner of the neuron, empty for unpaired
+	// neurons.
+	Partner  string `json:"partner,omitempty"`
+	Ganglion string `json:"ganglion"`
+	// Position is the approximate position of the cell body along the body
+	// axis, from 0 at the nose to 1 at the tail.
+	Position float64 `json:"position"`
+	// CellClass is the anatomical class of the neuron, e.g. "AVA" for AVAL
+	// and AVAR or "VA" for VA1 to VA12. It defaults to the neuron's own name.
+	CellClass string `json:"cell_class"`
+}
+
+// registry holds the metadata of every neuron in the state.
+type registry struct {
+	neurons []neuronInfo
+	byName  map[string]int
+}
+
+// LoadRegistry loads the neuron metadata from a local CSV or JSON file. The
+// metadata bundled with the service is used when path is empty.
+//
+// CSV files use the name,class,neurotransmitter,partner,ganglion,position
+// layout with an optional cell_class column. JSON files contain an array of
+// objects with the same fields.
+func LoadRegistry(path string) (*registry, error) {
+	data, format, err := readData(path, "neurons.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	var neurons []neuronInfo
+	switch format {
+	case formatCSV:
+		neurons, err = parseRegistryCSV(bytes.NewReader(data))
+	case formatJSON:
+		err = json.Unmarshal(data, &neurons)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing neuron registry: %w", err)
+	}
+
+	r := &registry{byName: make(map[string]int, len(neurons))}
+	for _, info := range neurons {
+		if !slices.Contains(neuronClasses, info.Class) {
+			return nil, fmt.Errorf("invalid class %q for %s", info.Class, info.Name)
+		}
+		info.Name = neuronKey(info.Name)
+		if info.Partner != "" {
+			info.Partner = neuronKey(info.Partner)
+		}
+		if info.CellClass == "" {
+			info.CellClass = strings.TrimPrefix(info.Name, "N_")
+		}
+		if _, ok := r.byName[info.Name]; ok {
+			return nil, fmt.Errorf("duplicate neuron %s in registry", info.Name)
+		}
+		r.byName[info.Name] = len(r.neurons)
+		r.neurons = append(r.neurons, info)
+	}
+
+	return r, nil
+}
+
+func parseRegistryCSV(r io.Reader) ([]neuronInfo, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	// The header sets the number of fields of every record
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	if len(header) != 6 && len(header) != 7 {
+		return nil, fmt.Errorf("expected 6 or 7 columns, got %d", len(header))
+	}
+
+	var neurons []neuronInfo
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %w", err)
+		}
+
+		position, err := strconv.ParseFloat(record[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid position %q for %s: %w", record[5], record[0], err)
+		}
+
+		info := neuronInfo{
+			Name:             record[0],
+			Class:            record[1],
+			Neurotransmitter: record[2],
+			Partner:          record[3],
+			Ganglion:         record[4],
+			Position:         position,
+		}
+		if len(record) > 6 {
+			info.CellClass = record[6]
+		}
+		neurons = append(neurons, info)
+	}
+
+	return neurons, nil
+}
+
+// info returns the metadata of a neuron.
+func (r *registry) info(neuron string) (neuronInfo, bool) {
+	i, ok := r.byName[neuron]
+	if !ok {
+		return neuronInfo{}, false
+	}
+	return r.neurons[i], true
+}
+
+// class returns the metadata of every neuron of the given class. An empty
+// class returns every neuron.
+func (r *registry) class(class string) []neuronInfo {
+	if class == "" {
+		return slices.Clone(r.neurons)
+	}
+	var neurons []neuronInfo
+	for _, info := range r.neurons {
+		if info.Class == class {
+			neurons = append(neurons, info)
+		}
+	}
+	return neurons
+}
+
+// describe returns a plain text listing of the neurons in each class, used to
+// tell the LLM what the neurons in the state maps really are.
+func (r *registry) describe() string {
+	var sb strings.Builder
+	sb.WriteString("Neuron classes:\n")
+	for _, class := range neuronClasses {
+		var names []string
+		for _, info := range r.class(class) {
+			names = append(names, info.Name)
+		}
+		fmt.Fprintf(&sb, "- %s: %s\n", class, strings.Join(names, ", "))
+	}
+	return sb.String()
+}
+
+// validate checks the registry describes exactly the neurons in the roster
+// and that bilateral partners refer to each other.
+func (r *registry) validate(ros *roster, known map[string]bool) []error {
+	var errs []error
+	for _, entry := range ros.entries {
+		if _, ok := r.byName[entry.Name]; !ok {
+			errs = append(errs, fmt.Errorf("no registry entry for neuron %s", entry.Name))
+		}
+	}
+	for _, info := range r.neurons {
+		if !known[info.Name] {
+			errs = append(errs, fmt.Errorf("registry entry for unknown neuron %s", info.Name))
+		}
+		if info.Partner == "" {
+			continue
+		}
+		partner, ok := r.info(info.Partner)
+		if !ok || partner.Partner != info.Name {
+			errs = append(errs, fmt.Errorf("bilateral partner %s of %s does not refer back to it", info.Partner, info.Name))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,114 @@
+package nema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Neurons are stored in one of the two state maps depending on their group.
+const (
+	groupMotor   = "motor"
+	groupSensory = "sensory"
+)
+
+// rosterEntry describes a single neuron known to the service.
+type rosterEntry struct {
+	Name    string `json:"name"`
+	Group   string `json:"group"`
+	Initial int    `json:"initial"`
+}
+
+// roster is the list of every neuron in the state together with its initial
+// value.
+type roster struct {
+	entries []rosterEntry
+	// index is shared by every state created from the roster
+	index *neuronIndex
+}
+
+// LoadRoster loads the neuron roster from a local CSV or JSON file. The roster
+// bundled with the service is used when path is empty.
+//
+// CSV files use the name,group,initial layout. JSON files contain an array of
+// objects with the same fields.
+func LoadRoster(path string) (*roster, error) {
+	data, format, err := readData(path, "roster.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []rosterEntry
+	switch format {
+	case formatCSV:
+		entries, err = parseRosterCSV(bytes.NewReader(data))
+	case formatJSON:
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing roster: %w", err)
+	}
+
+	for i, entry := range entries {
+		if entry.Group != groupMotor && entry.Group != groupSensory {
+			return nil, fmt.Errorf("invalid group %q for %s", entry.Group, entry.Name)
+		}
+		if !validValue(entry.Initial) {
+			return nil, fmt.Errorf("invalid initial value %d for %s", entry.Initial, entry.Name)
+		}
+		entries[i].Name = neuronKey(entry.Name)
+		if entries[i].Name == "" {
+			return nil, fmt.Errorf("missing neuron name in roster entry %d", i+1)
+		}
+	}
+
+	var motor, sensory []string
+	for _, entry := range entries {
+		if entry.Group == groupMotor {
+			motor = append(motor, entry.Name)
+		} else {
+			sensory = append(sensory, entry.Name)
+		}
+	}
+
+	return &roster{entries: entries, index: newNeuronIndex(motor, sensory)}, nil
+}
+
+func parseRosterCSV(r io.Reader) ([]rosterEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	// Skip the header
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+
+	var entries []rosterEntry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %w", err)
+		}
+
+		initial, err := strconv.Atoi(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid initial value %q for %s: %w", record[2], record[0], err)
+		}
+
+		entries = append(entries, rosterEntry{
+			Name:    record[0],
+			Group:   record[1],
+			Initial: initial,
+		})
+	}
+
+	return entries, nil
+}
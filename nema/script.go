@@ -0,0 +1,164 @@
+package nema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ScriptedStimulus is a stimulus applied from a given step of a batch run.
+type ScriptedStimulus struct {
+	// Step is the step at which the stimulus starts, counting from 0.
+	Step int `json:"step"`
+	Stimulus
+}
+
+// LoadScript loads a stimulus script from a local CSV or JSON file. An empty
+// path returns an empty script.
+//
+// CSV files use the step,type,intensity,duration layout. JSON files contain an
+// array of objects with the same fields.
+func LoadScript(path string) ([]ScriptedStimulus, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, format, err := readData(path, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var script []ScriptedStimulus
+	switch format {
+	case formatCSV:
+		script, err = parseScriptCSV(bytes.NewReader(data))
+	case formatJSON:
+		err = json.Unmarshal(data, &script)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing script: %w", err)
+	}
+
+	for i, s := range script {
+		if s.Step < 0 {
+			return nil, fmt.Errorf("invalid step %d in script entry %d", s.Step, i+1)
+		}
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("script entry %d: %w", i+1, err)
+		}
+	}
+
+	return script, nil
+}
+
+func parseScriptCSV(r io.Reader) ([]ScriptedStimulus, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	// Skip the header
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+
+	var script []ScriptedStimulus
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		step, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid step %q: %w", record[0], err)
+		}
+		intensity, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid intensity %q: %w", record[2], err)
+		}
+		duration, err := strconv.Atoi(record[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", record[3], err)
+		}
+
+		script = append(script, ScriptedStimulus{
+			Step:     step,
+			Stimulus: Stimulus{Type: record[1], Intensity: intensity, Duration: duration},
+		})
+	}
+
+	return script, nil
+}
+
+// ReadState parses a state as written by JSONString. The state has not learned
+// anything.
+func ReadState(data []byte) (neuro, error) {
+	var n neuro
+	if err := json.Unmarshal(data, &n); err != nil {
+		return neuro{}, fmt.Errorf("error parsing state: %w", err)
+	}
+	if n.index.len() == 0 {
+		return neuro{}, errors.New("state has no neurons")
+	}
+	return n, nil
+}
+
+// Sample is the state of the worm after a step of a batch run.
+type Sample struct {
+	Step        int            `json:"step"`
+	Neurons     map[string]int `json:"neurons"`
+	Environment environment    `json:"environment"`
+	Modulators  modulators     `json:"modulators"`
+	Behavior    behavior       `json:"behavior"`
+	Lifecycle   lifecycle      `json:"lifecycle"`
+	Sleep       sleep          `json:"sleep"`
+}
+
+// RunScript advances the state by the given number of steps, applying every
+// scripted stimulus for its duration from its starting step, and records a
+// sample after every step. Touch neurons habituate at the end of each
+// mechanosensory stimulus and the worm eats from food stimuli as it does for
+// stimuli applied through the API.
+func (s *simulator) RunScript(n *neuro, steps int, script []ScriptedStimulus, record func(Sample) error) error {
+	for step := range steps {
+		input := make(map[string]float64)
+		for _, st := range script {
+			if step < st.Step || step >= st.Step+st.Duration {
+				continue
+			}
+			for name, value := range st.input() {
+				input[name] += value
+			}
+		}
+
+		s.Run(n, 1, input)
+
+		for _, st := range script {
+			if step == st.Step+st.Duration-1 {
+				s.habituate(n, st.Stimulus)
+				n.Lifecycle.feed(st.Stimulus)
+			}
+		}
+
+		sample := Sample{
+			Step:        step,
+			Neurons:     n.neurons(),
+			Environment: n.Environment,
+			Modulators:  n.Modulators,
+			Behavior:    classifyBehavior(n),
+			Lifecycle:   n.Lifecycle,
+			Sleep:       n.Sleep,
+		}
+		if err := record(sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package nema
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+const (
+	// synapseGain scales the weighted presynaptic activity into postsynaptic
+	// input.
+	synapseGain = 0.1
+	// gapJunctionGain scales the current flowing through a gap junction for a
+	// given potential difference between the coupled neurons.
+	gapJunctionGain = 0.005
+	// stepsPerPrompt is the number of simulation steps run after the LLM
+	// updates the state. It is enough for activity to travel from the sensory
+	// neurons through the interneurons and motor neurons to the muscles.
+	stepsPerPrompt = 5
+)
+
+// SimConfig holds the settings of a simulator.
+type SimConfig struct {
+	Model NeuronModel
+	// Params are the per-neuron parameters. Neurons without an entry use the
+	// default parameters.
+	Params     map[string]NeuronParams
+	Plasticity PlasticityConfig
+	// Noise is the standard deviation of the random input every neuron
+	// receives per step. Zero disables the noise.
+	Noise float64
+	// Seed seeds the random number generator used for the noise.
+	Seed uint64
+}
+
+// simulator advances the neural state using the connectome and a neuron
+// model.
+type simulator struct {
+	connectome *connectome
+	cfg        SimConfig
+	model      NeuronModel
+	params     map[string]NeuronParams
+	plate      plate
+	plasticity PlasticityConfig
+	noise      float64
+	rand       *rand.Rand
+
+	// networks caches the network laid out for each neuron index
+	mu       sync.Mutex
+	networks map[*neuronIndex]*network
+}
+
+// NewSimulator creates a simulator. Every source of randomness in the
+// simulation is drawn from a generator seeded with cfg.Seed.
+func NewSimulator(c *connectome, cfg SimConfig) *simulator {
+	return &simulator{
+		connectome: c,
+		cfg:        cfg,
+		model:      cfg.Model,
+		params:     cfg.Params,
+		plate:      defaultPlate,
+		plasticity: cfg.Plasticity,
+		noise:      cfg.Noise,
+		rand:       rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)),
+		networks:   make(map[*neuronIndex]*network),
+	}
+}
+
+// fork returns a simulator with the same connectome and settings and its own
+// random number generator, so several worms can be simulated at once.
+func (s *simulator) fork() *simulator {
+	return NewSimulator(s.connectome, s.cfg)
+}
+
+// neuronParams returns the parameters of a neuron.
+func (s *simulator) neuronParams(neuron string) NeuronParams {
+	if p, ok := s.params[neuron]; ok {
+		return p
+	}
+	return defaultNeuronParams
+}
+
+// network returns the connectome, the neuron parameters and the modulator
+// targets laid out for the given neuron index.
+func (s *simulator) network(x *neuronIndex) *network {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if net, ok := s.networks[x]; ok {
+		return net
+	}
+	net := newNetwork(s, x)
+	s.networks[x] = net
+	return net
+}
+
+// Run advances the state by the given number of steps. Before every step the
+// worm senses its surroundings on the plate and eats from the food there, and
+// after it the worm crawls according to its motor output. The stimulus input,
+// if any, is added to the sensory input of every step. A stimulus disturbs the
+// worm's rest and a strong one wakes her up, and after every step the worm may
+// fall asleep or wake up.
+func (s *simulator) Run(n *neuro, steps int, stimulus map[string]float64) {
+	for range steps {
+		external := n.Environment.sense(s.plate)
+		n.Lifecycle.advance(stepDuration, n.Environment.Food)
+		n.Sleep.rest(stepDuration)
+		n.Sleep.arouse(n, stimulus)
+		for name, value := range stimulus {
+			external[name] += value
+		}
+		sleepInput(n, external)
+		s.Step(n, external)
+		n.Sleep.update(n)
+		n.Environment.move(s.plate, n)
+	}
+}
+
+// Step advances the state by a single tick. Every neuron's next value is
+// computed from the current values, so the order in which neurons are updated
+// does not matter.
+//
+// The neuron model decides how much transmitter a presynaptic neuron releases
+// across its chemical synapses. Gap junctions pass current in both directions,
+// pulling the coupled neurons towards each other's potential. Each neuron then
+// integrates its synaptic input and any external input according to the
+// model, scaled by the neuromodulators. Finally the modulators are released by
+// the updated neurons and the synapses learn from the activity they carried.
+//
+// Chemical synapses are scaled by their learned weight and habituated touch
+// neurons release less transmitter. Lesioned neurons are held at their value,
+// ablated and silenced neurons release no transmitter and the gap junctions
+// of ablated neurons are cut. The motor circuits of a sleeping worm barely
+// respond to their input.
+func (s *simulator) Step(n *neuro, external map[string]float64) {
+	net := s.network(n.index)
+
+	input := make([]float32, len(n.values))
+	for name, value := range external {
+		if i, ok := n.index.position(name); ok {
+			input[i] += float32(value)
+		}
+	}
+	lesioned := n.lesionKinds()
+	for _, syn := range net.chemical {
+		if lesioned != nil && (lesioned[syn.pre] == LesionAblate || lesioned[syn.pre] == LesionSilence) {
+			continue
+		}
+		output := s.model.Output(net.params[syn.pre], float64(n.values[syn.pre])) * n.learning.response(syn.key.Pre)
+		weight := syn.weight * n.learning.weight(syn.key)
+		input[syn.post] += float32(weight * output * synapseGain)
+	}
+	for _, gj := range net.electrical {
+		if lesioned != nil && (lesioned[gj.pre] == LesionAblate || lesioned[gj.post] == LesionAblate) {
+			continue
+		}
+		current := float32(gj.weight * (float64(n.values[gj.pre]) - float64(n.values[gj.post])) * gapJunctionGain)
+		input[gj.post] += current
+		input[gj.pre] -= current
+	}
+	if s.noise > 0 {
+		// The neurons are sorted by name, so a seeded run is reproducible
+		for i := range input {
+			input[i] += float32(s.rand.NormFloat64() * s.noise)
+		}
+	}
+
+	var gains [targetPharyngeal + 1]float64
+	for t := range gains {
+		gains[t] = n.Modulators.gain(modulatorTarget(t))
+		if n.Sleep.Asleep && modulatorTarget(t) != targetNone {
+			gains[t] *= sleepMotorGain
+		}
+	}
+
+	prev := slices.Clone(n.values)
+	for i, value := range prev {
+		in := float64(input[i]) * gains[net.targets[i]]
+		v := s.model.Update(net.params[i], float64(value), in)
+		n.values[i] = int8(clampValue(v))
+	}
+	n.holdLesions()
+	n.Modulators.update(n)
+
+	s.learn(net, prev, n)
+}
+
+// learn applies Hebbian learning to the chemical synapses, pairing the
+// activity of each presynaptic neuron before the step with the activity of
+// its postsynaptic neuron after it, and lets habituated neurons recover.
+func (s *simulator) learn(net *network, prev []int8, n *neuro) {
+	if rate := s.plasticity.HebbianRate; rate > 0 {
+		for _, syn := range net.chemical {
+			pre := depolarisation(float64(prev[syn.pre]))
+			post := depolarisation(float64(n.values[syn.post]))
+			n.learning.hebbian(syn.key, rate, pre, post)
+		}
+	}
+	n.learning.recoverHabituation(s.plasticity.RecoveryRate)
+}
+
+// habituate makes the touch neurons targeted by a mechanosensory stimulus
+// respond less to the next one.
+func (s *simulator) habituate(n *neuro, stimulus Stimulus) {
+	if !mechanosensoryStimuli[stimulus.Type] {
+		return
+	}
+	n.learning.habituate(stimulus.neurons(), s.plasticity.HabituationRate)
+}
+
+// clampValue rounds a value to the nearest integer within the valid neuron
+// range.
+func clampValue(v float64) int {
+	v = math.Round(v)
+	if v > 127 {
+		return 127
+	}
+	if v < -128 {
+		return -128
+	}
+	return int(v)
+}
@@ -0,0 +1,182 @@
+package nema
+
+import (
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// risNeuron is the sleep-active interneuron whose GABA and neuropeptide
+	// release makes the worm quiescent.
+	risNeuron = "N_RIS"
+
+	// risSatietyGain is the input RIS receives per step from a full gut, as
+	// food signals promote satiety quiescence. risSleepInput is the input
+	// that keeps RIS active while the worm sleeps.
+	risSatietyGain = 10
+	risSleepInput  = 10
+
+	// quietToSleep is how long the worm must be left alone before a full gut
+	// drives RIS at its full gain. Satiety quiescence follows a calm period
+	// rather than every meal, so a busy worm stays awake however well fed.
+	quietToSleep = 10 * time.Minute
+
+	// The worm falls asleep when RIS is at least risSleepActivity active and
+	// its gut is at least sleepSatiety full. It wakes up when RIS falls below
+	// risWakeActivity or hunger empties its gut below wakeSatiety.
+	risSleepActivity = 0.5
+	risWakeActivity  = 0.2
+	sleepSatiety     = 0.8
+	wakeSatiety      = 0.5
+
+	// arousalInput is the stimulus input to a single neuron that wakes the
+	// worm up. Weaker stimuli are dampened by sleepSensoryGain. Stimuli of at
+	// least disturbInput keep an awake worm from settling down.
+	arousalInput     = 0.6 * stimulusGain
+	disturbInput     = 0.2 * stimulusGain
+	sleepSensoryGain = 0.2
+	// sleepMotorGain scales the synaptic input of the locomotion, head and
+	// pharyngeal motor circuits while the worm sleeps.
+	sleepMotorGain = 0.1
+)
+
+// Reasons the worm fell asleep or woke up
+const (
+	sleepReasonSatiety  = "satiety"
+	sleepReasonStimulus = "stimulus"
+	sleepReasonHunger   = "hunger"
+	sleepReasonRIS      = "ris"
+)
+
+// sleep is whether the worm is quiescent.
+type sleep struct {
+	Asleep bool `json:"asleep"`
+	// Reason is why the worm last fell asleep or woke up.
+	Reason string `json:"reason,omitempty"`
+	// QuietMinutes is how long the worm has been left alone since she was
+	// last disturbed or woke up.
+	QuietMinutes float64 `json:"quiet_minutes,omitempty"`
+}
+
+// arouse disturbs the worm with the strongest input of a stimulus.
+func (s *sleep) arouse(n *neuro, stimulus map[string]float64) {
+	var strongest float64
+	for _, value := range stimulus {
+		strongest = math.Max(strongest, math.Abs(value))
+	}
+	s.disturb(n, strongest)
+}
+
+// disturb resets the quiet time if the input is at least disturbInput and
+// wakes the worm up if it is at least arousalInput. Arousal inhibits RIS, so
+// the worm stays awake for a while even if it is still full.
+func (s *sleep) disturb(n *neuro, input float64) {
+	if input < disturbInput {
+		return
+	}
+	s.QuietMinutes = 0
+	if s.Asleep && input >= arousalInput {
+		s.Asleep, s.Reason = false, sleepReasonStimulus
+		n.set(risNeuron, 0)
+	}
+}
+
+// rest lets the given time pass undisturbed.
+func (s *sleep) rest(d time.Duration) {
+	s.QuietMinutes += d.Minutes()
+}
+
+// pressure returns how close the worm is to having been left alone for
+// quietToSleep, between 0 and 1.
+func (s *sleep) pressure() float64 {
+	return math.Min(s.QuietMinutes/quietToSleep.Minutes(), 1)
+}
+
+// update puts the worm to sleep or wakes it up according to the activity of
+// RIS, how full its gut is and how long she has been left alone. Waking up
+// starts the quiet time over.
+func (s *sleep) update(n *neuro) {
+	ris := activity(n, risNeuron)
+	switch {
+	case s.Asleep && n.Lifecycle.Satiety < wakeSatiety:
+		s.Asleep, s.Reason, s.QuietMinutes = false, sleepReasonHunger, 0
+	case s.Asleep && ris < risWakeActivity:
+		s.Asleep, s.Reason, s.QuietMinutes = false, sleepReasonRIS, 0
+	case !s.Asleep && ris >= risSleepActivity && n.Lifecycle.Satiety >= sleepSatiety && s.pressure() >= 1:
+		s.Asleep, s.Reason = true, sleepReasonSatiety
+	}
+}
+
+// sleepInput adds the sleep related input to the external input of a step.
+// Satiety drives RIS in proportion to how long the worm has been left alone,
+// and a sleeping worm keeps RIS active and senses its surroundings and weak
+// stimuli less.
+func sleepInput(n *neuro, external map[string]float64) {
+	if n.Sleep.Asleep {
+		for name := range external {
+			external[name] *= sleepSensoryGain
+		}
+		external[risNeuron] += risSleepInput
+	}
+	external[risNeuron] += risSatietyGain * n.Lifecycle.Satiety * n.Sleep.pressure()
+}
+
+// describe returns a sentence about the sleep state for the LLM.
+func (s *sleep) describe() string {
+	if s.Asleep {
+		return "Nema is sleeping. She barely moves and only strong stimuli wake her up."
+	}
+	return "Nema is awake."
+}
+
+// sleepBout is a period the worm spent asleep. A bout that has not ended yet
+// has no end.
+type sleepBout struct {
+	Start      time.Time  `json:"start"`
+	End        *time.Time `json:"end,omitempty"`
+	WakeReason string     `json:"wake_reason,omitempty"`
+}
+
+// sleepInfo is the sleep state of the worm together with its last bouts.
+type sleepInfo struct {
+	sleep
+	History []sleepBout `json:"history"`
+}
+
+// trackSleep records the start or end of a sleep bout if the worm fell asleep
+// or woke up since it was asleep as given. It must be called with the lock
+// held.
+func (m *Manager) trackSleep(wasAsleep bool) {
+	s := m.state.Sleep
+	if s.Asleep == wasAsleep {
+		return
+	}
+
+	now := m.clock.Now()
+	var err error
+	if s.Asleep {
+		m.log.Info("nema fell asleep", zap.String("reason", s.Reason))
+		err = m.db.startSleep(now)
+	} else {
+		m.log.Info("nema woke up", zap.String("reason", s.Reason))
+		err = m.db.endSleep(now, s.Reason)
+	}
+	if err != nil {
+		m.log.Error("error saving sleep bout", zap.Error(err))
+	}
+}
+
+// Sleep returns whether the worm sleeps together with its last sleep bouts,
+// most recent first.
+func (m *Manager) Sleep(limit int) (sleepInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	history, err := m.db.getSleepBouts(limit)
+	if err != nil {
+		return sleepInfo{}, err
+	}
+	return sleepInfo{sleep: m.state.Sleep, History: history}, nil
+}
@@ -0,0 +1,101 @@
+package nema
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// maxStimulusDuration is the maximum number of steps a stimulus can be
+	// applied for.
+	maxStimulusDuration = 100
+	// stimulusGain is the input a sensory neuron receives per step from a
+	// stimulus at full intensity.
+	stimulusGain = 127
+)
+
+// ErrInvalidStimulus is returned when a stimulus has an unknown type or its
+// intensity or duration is out of range.
+var ErrInvalidStimulus = errors.New("invalid stimulus")
+
+// Stimulus is a typed sensory stimulus applied to the worm.
+type Stimulus struct {
+	// Type is one of the keys of stimulusTargets, e.g. "anterior_touch".
+	Type string `json:"type"`
+	// Intensity is the strength of the stimulus between 0 and 1.
+	Intensity float64 `json:"intensity"`
+	// Duration is the number of simulation steps the stimulus is applied
+	// for.
+	Duration int `json:"duration"`
+}
+
+// stimulusTargets maps each stimulus type to the sensory neurons it acts on.
+// A negative sign hyperpolarises the neuron, e.g. odor silences the AWC "OFF"
+// neurons and salt silences ASER which responds to salt removal. Food is both
+// smelled by AWA and felt by the dopaminergic CEP, ADE and PDE neurons, which
+// sense the texture of a bacterial lawn.
+var stimulusTargets = map[string]map[string]float64{
+	"tap": {
+		"N_ALML": 1, "N_ALMR": 1, "N_AVM": 1, "N_PLML": 1, "N_PLMR": 1, "N_PVM": 1,
+	},
+	"anterior_touch": {
+		"N_ALML": 1, "N_ALMR": 1, "N_AVM": 1,
+	},
+	"posterior_touch": {
+		"N_PLML": 1, "N_PLMR": 1,
+	},
+	"nose_touch": {
+		"N_ASHL": 1, "N_ASHR": 1, "N_FLPL": 1, "N_FLPR": 1,
+	},
+	"nacl": {
+		"N_ASEL": 1, "N_ASER": -1,
+	},
+	"odor": {
+		"N_AWAL": 1, "N_AWAR": 1, "N_AWCL": -1, "N_AWCR": -1,
+	},
+	"heat": {
+		"N_AFDL": 1, "N_AFDR": 1,
+	},
+	"cold": {
+		"N_AFDL": -1, "N_AFDR": -1,
+	},
+	"food": {
+		"N_AWAL": 1, "N_AWAR": 1,
+		"N_CEPDL": 1, "N_CEPDR": 1, "N_CEPVL": 1, "N_CEPVR": 1,
+		"N_ADEL": 1, "N_ADER": 1, "N_PDEL": 1, "N_PDER": 1,
+	},
+}
+
+// validate checks the stimulus type is known and its intensity and duration
+// are in range.
+func (s Stimulus) validate() error {
+	if _, ok := stimulusTargets[s.Type]; !ok {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidStimulus, s.Type)
+	}
+	if s.Intensity < 0 || s.Intensity > 1 {
+		return fmt.Errorf("%w: intensity %v must be between 0 and 1", ErrInvalidStimulus, s.Intensity)
+	}
+	if s.Duration < 1 || s.Duration > maxStimulusDuration {
+		return fmt.Errorf("%w: duration %d must be between 1 and %d", ErrInvalidStimulus, s.Duration, maxStimulusDuration)
+	}
+	return nil
+}
+
+// neurons returns the sensory neurons the stimulus acts on.
+func (s Stimulus) neurons() []string {
+	var neurons []string
+	for neuron := range stimulusTargets[s.Type] {
+		neurons = append(neurons, neuron)
+	}
+	return neurons
+}
+
+// input returns the external input the stimulus gives each sensory neuron per
+// step.
+func (s Stimulus) input() map[string]float64 {
+	input := make(map[string]float64)
+	for neuron, sign := range stimulusTargets[s.Type] {
+		input[neuron] = sign * s.Intensity * stimulusGain
+	}
+	return input
+}
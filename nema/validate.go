@@ -0,0 +1,228 @@
+package nema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/tmc/langchaingo/llms"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxRepairs is the number of times the LLM is asked to fix an invalid
+// answer before the prompt fails.
+const DefaultMaxRepairs = 2
+
+// ErrInvalidResponse is returned when the LLM keeps answering with output that
+// does not match the expected schema.
+var ErrInvalidResponse = errors.New("invalid LLM response")
+
+// llmResponseSchema is the JSON Schema of the answer to a prompt in direct
+// mode. It is given to the LLM with the initial prompt and enforced by
+// parseResponse, which also checks the neurons against the roster.
+const llmResponseSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["human_message", "changed"],
+  "properties": {
+    "human_message": {"type": "string", "minLength": 1},
+    "motor_neurons": {"type": "array", "items": {"$ref": "#/$defs/neuron"}},
+    "sensory_neurons": {"type": "array", "items": {"$ref": "#/$defs/neuron"}},
+    "changed": {"type": "boolean"}
+  },
+  "$defs": {
+    "neuron": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["neuron", "value"],
+      "properties": {
+        "neuron": {"type": "string", "pattern": "^N_"},
+        "value": {"type": "integer", "minimum": -128, "maximum": 127}
+      }
+    }
+  }
+}`
+
+// decodeStrict decodes a single JSON object into v, rejecting unknown fields
+// and trailing data.
+func decodeStrict(data string, v any) error {
+	dec := json.NewDecoder(bytes.NewReader([]byte(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("not a valid JSON object of the schema: %w", err)
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON object")
+	}
+	return nil
+}
+
+// parseResponse parses and validates the answer to a prompt in direct mode.
+// Every neuron must be in the roster, in the group it is listed in, and have
+// a value in range.
+func parseResponse(data string, n *neuro) (llmResponse, error) {
+	var raw struct {
+		HumanMessage *string `json:"human_message"`
+		MotorNeurons []struct {
+			Neuron *string `json:"neuron"`
+			Value  *int    `json:"value"`
+		} `json:"motor_neurons"`
+		SensoryNeurons []struct {
+			Neuron *string `json:"neuron"`
+			Value  *int    `json:"value"`
+		} `json:"sensory_neurons"`
+		Changed *bool `json:"changed"`
+	}
+	if err := decodeStrict(data, &raw); err != nil {
+		return llmResponse{}, err
+	}
+
+	var errs []error
+	if raw.HumanMessage == nil || *raw.HumanMessage == "" {
+		errs = append(errs, errors.New("human_message is required"))
+	}
+	if raw.Changed == nil {
+		errs = append(errs, errors.New("changed is required"))
+	}
+
+	var lr llmResponse
+	check := func(field string, i int, neuron *string, value *int, motor bool) {
+		switch {
+		case neuron == nil:
+			errs = append(errs, fmt.Errorf("%s[%d].neuron is required", field, i))
+			return
+		case value == nil:
+			errs = append(errs, fmt.Errorf("%s[%d].value is required", field, i))
+			return
+		case !validValue(*value):
+			errs = append(errs, fmt.Errorf("%s[%d]: value %d of %s must be between -128 and 127", field, i, *value, *neuron))
+			return
+		}
+		pos, ok := n.index.position(*neuron)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s[%d]: unknown neuron %q", field, i, *neuron))
+			return
+		}
+		if n.index.motor[pos] != motor {
+			errs = append(errs, fmt.Errorf("%s[%d]: %s is a %s neuron", field, i, *neuron, groupName(!motor)))
+			return
+		}
+		entry := struct {
+			Neuron string `json:"neuron"`
+			Value  int    `json:"value"`
+		}{*neuron, *value}
+		if motor {
+			lr.MotorNeurons = append(lr.MotorNeurons, entry)
+		} else {
+			lr.SensoryNeurons = append(lr.SensoryNeurons, entry)
+		}
+	}
+	for i, e := range raw.MotorNeurons {
+		check("motor_neurons", i, e.Neuron, e.Value, true)
+	}
+	for i, e := range raw.SensoryNeurons {
+		check("sensory_neurons", i, e.Neuron, e.Value, false)
+	}
+	if len(errs) > 0 {
+		return llmResponse{}, errors.Join(errs...)
+	}
+
+	lr.HumanMessage = *raw.HumanMessage
+	lr.Changed = *raw.Changed
+	return lr, nil
+}
+
+// parseReply parses and validates the reply in hybrid mode, which only holds
+// the human message.
+func parseReply(data string) (llmResponse, error) {
+	var raw struct {
+		HumanMessage *string `json:"human_message"`
+	}
+	if err := decodeStrict(data, &raw); err != nil {
+		return llmResponse{}, err
+	}
+	if raw.HumanMessage == nil || *raw.HumanMessage == "" {
+		return llmResponse{}, errors.New("human_message is required")
+	}
+	return llmResponse{HumanMessage: *raw.HumanMessage}, nil
+}
+
+// parseStimuli parses and validates the stimuli a prompt was interpreted as in
+// hybrid mode.
+func parseStimuli(data string) ([]Stimulus, error) {
+	var raw struct {
+		Stimuli *[]Stimulus `json:"stimuli"`
+	}
+	if err := decodeStrict(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Stimuli == nil {
+		return nil, errors.New("stimuli is required, use an empty array for none")
+	}
+
+	var errs []error
+	for i, s := range *raw.Stimuli {
+		if err := s.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("stimuli[%d]: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return *raw.Stimuli, nil
+}
+
+// groupName returns the name of the motor or sensory group of the state maps.
+func groupName(motor bool) string {
+	if motor {
+		return "motor"
+	}
+	return "sensory"
+}
+
+// repairPrompt asks the LLM to fix its last answer.
+func repairPrompt(err error) string {
+	return fmt.Sprintf("Your answer is invalid:\n%s\n\nAnswer again with only the corrected JSON object.", err)
+}
+
+// ask sends the messages to the LLM and hands the JSON object of the answer to
+// parse. An answer without one or that parse rejects is sent back with the
+// errors, up to maxRepairs times. The repair turns only live in a copy of the
+// messages, so the caller can add the accepted answer to the conversation
+// without the failed attempts.
+func (m *Manager) ask(ctx context.Context, messages []llms.MessageContent, parse func(string) error) (extraction, error) {
+	messages = slices.Clip(messages)
+	for attempt := 0; ; attempt++ {
+		response, err := m.generate(ctx, messages)
+		if err != nil {
+			return extraction{}, err
+		}
+
+		ex, err := extractResponse(response)
+		if ex.Reasoning != "" || ex.Discarded != "" {
+			m.log.Debug("discarded from llm response",
+				zap.String("reasoning", ex.Reasoning),
+				zap.String("discarded", ex.Discarded),
+			)
+		}
+		if err == nil {
+			err = parse(ex.JSON)
+		}
+		if err == nil {
+			return ex, nil
+		}
+		if attempt >= m.maxRepairs {
+			return extraction{}, fmt.Errorf("%w after %d attempts: %w", ErrInvalidResponse, attempt+1, err)
+		}
+
+		m.log.Warn("invalid llm response, asking for a repair", zap.Int("attempt", attempt+1), zap.Error(err))
+		messages = append(messages,
+			llms.TextParts(llms.ChatMessageTypeAI, response),
+			llms.TextParts(llms.ChatMessageTypeHuman, repairPrompt(err)),
+		)
+	}
+}
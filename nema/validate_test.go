@@ -0,0 +1,178 @@
+package nema
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+	"go.uber.org/zap"
+)
+
+// scriptedLLM answers with its answers in order, repeating the last one, and
+// records how many messages every call was given.
+type scriptedLLM struct {
+	answers []string
+	calls   []int
+}
+
+func (s *scriptedLLM) GenerateContent(_ context.Context, messages []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	answer := s.answers[min(len(s.calls), len(s.answers)-1)]
+	s.calls = append(s.calls, len(messages))
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: answer}}}, nil
+}
+
+func (s *scriptedLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, s, prompt, options...)
+}
+
+// newTestManager creates a worm with the default data on a fresh database.
+func newTestManager(t *testing.T, llm llms.Model, maxRepairs int) *Manager {
+	t.Helper()
+
+	db, err := NewDBManager(filepath.Join(t.TempDir(), "nema.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Initiate(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadRoster("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := LoadRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConnectome("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := LoadNeuronParams("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := NewNeuronModel("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(zap.NewNop(), db, Config{
+		InitialPrompt: "You are Nema. %s",
+		LLM:           llm,
+		Roster:        r,
+		Registry:      reg,
+		Simulator:     NewSimulator(c, SimConfig{Model: model, Params: params}),
+		MaxRepairs:    maxRepairs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestAskLLMRepairs(t *testing.T) {
+	const (
+		valid        = `{"human_message": "Hi!", "motor_neurons": [{"neuron": "N_MDL01", "value": 10}], "sensory_neurons": [], "changed": true}`
+		prose        = "I'm a worm, I can't answer in JSON."
+		unknown      = `{"human_message": "Hi!", "motor_neurons": [{"neuron": "N_NOPE", "value": 10}], "changed": true}`
+		wrongGroup   = `{"human_message": "Hi!", "sensory_neurons": [{"neuron": "N_MDL01", "value": 10}], "changed": true}`
+		missingField = `{"human_message": "Hi!"}`
+	)
+
+	tests := []struct {
+		name       string
+		answers    []string
+		maxRepairs int
+		calls      int
+		err        error
+	}{
+		{
+			name:    "valid answer",
+			answers: []string{valid},
+			calls:   1,
+		},
+		{
+			name:    "valid answer in prose and fences",
+			answers: []string{"Sure!\n```json\n" + valid + "\n```"},
+			calls:   1,
+		},
+		{
+			name:    "prose repaired",
+			answers: []string{prose, valid},
+			calls:   2,
+		},
+		{
+			name:    "unknown neuron then wrong group repaired",
+			answers: []string{unknown, wrongGroup, valid},
+			calls:   3,
+		},
+		{
+			name:    "missing field repaired",
+			answers: []string{missingField, valid},
+			calls:   2,
+		},
+		{
+			name:    "repairs run out",
+			answers: []string{prose, unknown, wrongGroup, valid},
+			calls:   3,
+			err:     ErrInvalidResponse,
+		},
+		{
+			name:       "more repairs allowed",
+			answers:    []string{prose, unknown, wrongGroup, valid},
+			maxRepairs: 3,
+			calls:      4,
+		},
+		{
+			name:       "repairs disabled",
+			answers:    []string{prose, valid},
+			maxRepairs: -1,
+			calls:      1,
+			err:        ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &scriptedLLM{answers: tt.answers}
+			m := newTestManager(t, llm, tt.maxRepairs)
+
+			lr, err := m.AskLLM(context.Background(), "Hello Nema")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if len(llm.calls) != tt.calls {
+				t.Fatalf("got %d calls, want %d", len(llm.calls), tt.calls)
+			}
+
+			// Every repair sends back the invalid answer and the repair prompt
+			for i, n := range llm.calls {
+				if want := llm.calls[0] + 2*i; n != want {
+					t.Errorf("call %d got %d messages, want %d", i+1, n, want)
+				}
+			}
+
+			// Only the prompt and the accepted answer join the conversation
+			if tt.err != nil {
+				if len(m.messages) != 1 {
+					t.Errorf("got %d messages after a failed prompt, want 1", len(m.messages))
+				}
+				return
+			}
+			if len(m.messages) != 3 {
+				t.Fatalf("got %d messages, want 3", len(m.messages))
+			}
+			if got := messageText(m.messages[2]); got != valid {
+				t.Errorf("got answer %q in the conversation, want %q", got, valid)
+			}
+			if lr.HumanMessage != "Hi!" || !lr.Changed {
+				t.Errorf("got response %+v", lr)
+			}
+		})
+	}
+}
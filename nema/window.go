@@ -0,0 +1,172 @@
+package nema
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/tmc/langchaingo/llms"
+	"go.uber.org/zap"
+)
+
+// tokenModel is the model whose tokenizer counts the tokens of the
+// conversation. Other models tokenize differently, so the counts are an
+// estimate for them.
+const tokenModel = "gpt-4"
+
+// WindowConfig holds the settings of the conversation window sent to the LLM
+// with every prompt.
+type WindowConfig struct {
+	// TokenBudget is the most tokens the conversation may hold before older
+	// turns are compacted into a summary. Zero disables the budget.
+	TokenBudget int
+	// KeepTurns is how many of the most recent prompts and answers are always
+	// kept verbatim.
+	KeepTurns int
+}
+
+// DefaultWindowConfig leaves room for the initial prompt with the full state
+// and a few dozen turns.
+var DefaultWindowConfig = WindowConfig{
+	TokenBudget: 16000,
+	KeepTurns:   4,
+}
+
+// SummaryPrefix starts the prompt that summarizes the conversation. It is
+// exported so the mock LLM can tell the prompt apart.
+const SummaryPrefix = "Summarize the conversation"
+
+// summaryPrompt asks the LLM to fold the turns into the running summary.
+func summaryPrompt(summary string, turns []llms.MessageContent) string {
+	var b strings.Builder
+	b.WriteString(SummaryPrefix + " between humans and Nema, a C. elegans worm, below in a few sentences. ")
+	b.WriteString("Keep what the humans asked or did to Nema, how she reacted and anything she should remember. ")
+	b.WriteString("Leave out neuron values. Answer only with the summary.\n\n")
+	if summary != "" {
+		b.WriteString("Summary of the conversation so far:\n")
+		b.WriteString(summary)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("Conversation to add:\n")
+	for _, message := range turns {
+		speaker := "Human"
+		if message.Role == llms.ChatMessageTypeAI {
+			speaker = "Nema"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", speaker, messageText(message))
+	}
+	return b.String()
+}
+
+// messageText returns the text parts of a message.
+func messageText(message llms.MessageContent) string {
+	var parts []string
+	for _, part := range message.Parts {
+		if text, ok := part.(llms.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// tokenizerAvailable tells whether the tokenizer could be loaded. tiktoken
+// downloads it on first use, and without a network every count would try
+// again, so the approximation of four characters per token is used instead.
+var tokenizerAvailable = sync.OnceValue(func() bool {
+	_, err := tiktoken.EncodingForModel(tokenModel)
+	return err == nil
+})
+
+// countTokens returns the number of tokens of the messages.
+func countTokens(messages []llms.MessageContent) int {
+	tokens := 0
+	for _, message := range messages {
+		text := messageText(message)
+		if tokenizerAvailable() {
+			tokens += llms.CountTokens(tokenModel, text)
+		} else {
+			tokens += utf8.RuneCountInString(text) / 4
+		}
+	}
+	return tokens
+}
+
+// history returns the conversation to send to the LLM: the initial prompt
+// followed by the running summary of the compacted turns, then the turns kept
+// verbatim.
+func (m *Manager) history() []llms.MessageContent {
+	first := m.messages[0]
+	if m.summary != "" {
+		text := messageText(first) + "\n\nSummary of your earlier conversation:\n" + m.summary
+		first = llms.TextParts(first.Role, text)
+	}
+
+	history := make([]llms.MessageContent, 0, len(m.messages))
+	history = append(history, first)
+	return append(history, m.messages[1:]...)
+}
+
+// remember saves a prompt and its accepted answer and adds them to the
+// conversation. It must be called with the lock held.
+func (m *Manager) remember(human, ai llms.MessageContent) error {
+	if err := m.db.saveMessages([]llms.MessageContent{human, ai}, m.clock.Now()); err != nil {
+		return fmt.Errorf("error saving conversation: %w", err)
+	}
+	m.messages = append(m.messages, human, ai)
+	return nil
+}
+
+// fitWindow compacts the oldest turns into the running summary when the
+// conversation together with the next prompt goes over the token budget. The
+// most recent turns are always kept. If the summary cannot be generated or
+// saved the turns are kept and compacting is tried again with the next prompt.
+// It must be called with the lock held.
+func (m *Manager) fitWindow(ctx context.Context, next llms.MessageContent) {
+	if m.window.TokenBudget <= 0 {
+		return
+	}
+
+	tokens := countTokens(append(m.history(), next))
+	if tokens <= m.window.TokenBudget {
+		return
+	}
+
+	// Every turn is a prompt and its answer
+	keep := 2 * max(m.window.KeepTurns, 0)
+	old := len(m.messages) - 1 - keep
+	if old <= 0 {
+		m.log.Warn("conversation over the token budget with only the recent turns",
+			zap.Int("tokens", tokens), zap.Int("budget", m.window.TokenBudget))
+		return
+	}
+	turns := m.messages[1 : 1+old]
+
+	response, err := m.generate(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, summaryPrompt(m.summary, turns)),
+	})
+	if err != nil {
+		m.log.Error("error summarizing conversation", zap.Error(err))
+		return
+	}
+	summary, _ := stripReasoning(response)
+	if summary == "" {
+		m.log.Error("error summarizing conversation: empty summary")
+		return
+	}
+
+	if err := m.db.compactMessages(old, summary, m.clock.Now()); err != nil {
+		m.log.Error("error saving conversation summary", zap.Error(err))
+		return
+	}
+	m.summary = summary
+	m.messages = append(m.messages[:1], m.messages[1+old:]...)
+
+	m.log.Info("conversation compacted",
+		zap.Int("messages", old),
+		zap.Int("tokens_before", tokens),
+		zap.Int("tokens_after", countTokens(append(m.history(), next))),
+	)
+}
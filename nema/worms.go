@@ -0,0 +1,170 @@
+package nema
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrUnknownWorm is returned when a worm is not in the registry.
+	ErrUnknownWorm = errors.New("unknown worm")
+	// ErrInvalidWorm is returned when creating a worm with an invalid or
+	// taken ID.
+	ErrInvalidWorm = errors.New("invalid worm")
+)
+
+// wormIDPattern is what a worm ID looks like, e.g. "nema" or "staging-2".
+var wormIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Worm is an entry of the worm registry.
+type Worm struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Worms runs a Manager for every worm in the registry, so the public Nema,
+// staging and experiment worms can live side by side in one service. The
+// worms share the config but each has its own state, conversation and
+// simulator.
+type Worms struct {
+	mu       sync.Mutex
+	log      *zap.Logger
+	db       *dbm
+	cfg      Config
+	worms    []Worm
+	managers map[string]*Manager
+}
+
+// NewWorms starts a manager for every worm in the registry. The database must
+// have been initiated, which registers the default worm.
+func NewWorms(log *zap.Logger, db *dbm, cfg Config) (*Worms, error) {
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock{}
+	}
+
+	worms, err := db.getWorms()
+	if err != nil {
+		return nil, fmt.Errorf("error getting worms: %w", err)
+	}
+
+	w := &Worms{
+		log:      log,
+		db:       db,
+		cfg:      cfg,
+		managers: make(map[string]*Manager),
+	}
+	for _, worm := range worms {
+		if err := w.start(worm); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := w.managers[DefaultWorm]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownWorm, DefaultWorm)
+	}
+
+	return w, nil
+}
+
+// start creates the manager of a worm and runs it. It must be called with the
+// lock held or before the worms are shared.
+func (w *Worms) start(worm Worm) error {
+	m, err := w.newManager(worm)
+	if err != nil {
+		return err
+	}
+
+	w.worms = append(w.worms, worm)
+	w.managers[worm.ID] = m
+	return nil
+}
+
+// newManager creates the manager of a worm with its own simulator.
+func (w *Worms) newManager(worm Worm) (*Manager, error) {
+	cfg := w.cfg
+	cfg.Simulator = w.cfg.Simulator.fork()
+
+	m, err := NewManager(w.log.With(zap.String("worm", worm.ID)), w.db.Worm(worm.ID), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating manager of worm %s: %w", worm.ID, err)
+	}
+	return m, nil
+}
+
+// Get returns the manager of a worm.
+func (w *Worms) Get(id string) (*Manager, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	m, ok := w.managers[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownWorm, id)
+	}
+	return m, nil
+}
+
+// Default returns the manager of the public Nema.
+func (w *Worms) Default() *Manager {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.managers[DefaultWorm]
+}
+
+// List returns every worm in the registry, oldest first.
+func (w *Worms) List() []Worm {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]Worm(nil), w.worms...)
+}
+
+// Create registers a new worm with a fresh state and starts its manager.
+func (w *Worms) Create(id string) (Worm, error) {
+	if !wormIDPattern.MatchString(id) {
+		return Worm{}, fmt.Errorf("%w: id %q must be lowercase letters, digits, - or _", ErrInvalidWorm, id)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.managers[id]; ok {
+		return Worm{}, fmt.Errorf("%w: %s already exists", ErrInvalidWorm, id)
+	}
+
+	// The manager is created before the worm is registered, so a worm that
+	// cannot start leaves no row behind for the next start of the service
+	worm := Worm{ID: id, CreatedAt: w.cfg.Clock.Now()}
+	m, err := w.newManager(worm)
+	if err != nil {
+		return Worm{}, err
+	}
+	if err := w.db.createWorm(worm.ID, worm.CreatedAt); err != nil {
+		if errors.Is(err, errWormExists) {
+			return Worm{}, fmt.Errorf("%w: %s already exists", ErrInvalidWorm, id)
+		}
+		return Worm{}, err
+	}
+	w.worms = append(w.worms, worm)
+	w.managers[worm.ID] = m
+
+	w.log.Info("worm created", zap.String("worm", id))
+
+	return worm, nil
+}
+
+// running returns the managers of every worm.
+func (w *Worms) running() []*Manager {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	managers := make([]*Manager, 0, len(w.worms))
+	for _, worm := range w.worms {
+		managers = append(managers, w.managers[worm.ID])
+	}
+	return managers
+}
@@ -2,7 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/brainsonchain/nema/nema"
 )
 
 // tweet returns
@@ -47,3 +53,109 @@ func (s *Server) tweetReply(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// lesions is a handler that returns the current lesions of the nema.
+func (s *Server) lesions(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.Lesions()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// lesion is a handler that ablates, silences or clamps a neuron or a class of
+// neurons and returns the lesions applied.
+func (s *Server) lesion(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Target string `json:"target"`
+		Kind   string `json:"kind"`
+		Value  int    `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.log.Info("incoming lesion", zap.String("target", req.Target), zap.String("kind", req.Kind))
+
+	lesions, err := m.Lesion(req.Target, req.Kind, req.Value)
+	if err != nil {
+		if errors.Is(err, nema.ErrInvalidLesion) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lesions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// removeLesion is a handler that reverses the lesions of a neuron or a class
+// of neurons, or every lesion without a target, and returns the lesions
+// removed.
+func (s *Server) removeLesion(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	lesions, err := m.RemoveLesion(chi.URLParam(r, "target"))
+	if err != nil {
+		if errors.Is(err, nema.ErrInvalidLesion) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lesions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// createWorm is a handler that registers a new worm with a fresh state and
+// returns it.
+func (s *Server) createWorm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	worm, err := s.worms.Create(req.ID)
+	if err != nil {
+		if errors.Is(err, nema.ErrInvalidWorm) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(worm); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -2,15 +2,90 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"go.uber.org/zap"
+
+	"github.com/brainsonchain/nema/nema"
 )
 
-// nemaState is a handler that returns the current state of the nema.
+// nemaState is a handler that returns the current state of the nema. With the
+// group=class query parameter the neuron values are grouped by neuron class.
 func (s *Server) nemaState(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	var state any = m.GetState()
+	if r.URL.Query().Get("group") == "class" {
+		state = m.StateByClass()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// nemaPosture is a handler that returns the body posture of the nema.
+func (s *Server) nemaPosture(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.Posture()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// nemaNeurons is a handler that returns the metadata and current value of each
+// neuron. The optional class query parameter filters the neurons by class.
+func (s *Server) nemaNeurons(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.Neurons(r.URL.Query().Get("class"))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// nemaSleep is a handler that returns whether the nema sleeps together with
+// her last sleep bouts. The optional limit query parameter sets the number of
+// bouts, 20 by default.
+func (s *Server) nemaSleep(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sleep, err := m.Sleep(limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(s.nemaManager.GetState()); err != nil {
+	if err := json.NewEncoder(w).Encode(sleep); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -20,6 +95,11 @@ func (s *Server) nemaState(w http.ResponseWriter, r *http.Request) {
 // nemaPrompt is a handler that takes a incoming prompt, asks the LLM, and
 // returns the response.
 func (s *Server) nemaPrompt(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
 	// Read the request body
 	var prompt struct {
 		Prompt string `json:"prompt"`
@@ -31,18 +111,34 @@ func (s *Server) nemaPrompt(w http.ResponseWriter, r *http.Request) {
 
 	s.log.Info("incoming prompt", zap.String("prompt", prompt.Prompt))
 
-	response, err := s.nemaManager.AskLLM(r.Context(), prompt.Prompt)
+	response, err := m.AskLLM(r.Context(), prompt.Prompt)
 	if err != nil {
+		if errors.Is(err, nema.ErrInvalidResponse) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	type behavior struct {
+		Label      string  `json:"label"`
+		Confidence float64 `json:"confidence"`
+	}
+
 	type resp struct {
-		HumanMessage string `json:"human_message"`
+		HumanMessage string   `json:"human_message"`
+		Behavior     behavior `json:"behavior"`
+		Asleep       bool     `json:"asleep"`
 	}
 
 	jsonResp := resp{
 		HumanMessage: response.HumanMessage,
+		Asleep:       response.Asleep,
+		Behavior: behavior{
+			Label:      response.Behavior.Label,
+			Confidence: response.Behavior.Confidence,
+		},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -51,3 +147,45 @@ func (s *Server) nemaPrompt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// nemaStimulus is a handler that applies a typed sensory stimulus to the nema
+// and returns the resulting state.
+func (s *Server) nemaStimulus(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.manager(w, r)
+	if !ok {
+		return
+	}
+
+	var stimulus nema.Stimulus
+	if err := json.NewDecoder(r.Body).Decode(&stimulus); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.log.Info("incoming stimulus", zap.Any("stimulus", stimulus))
+
+	state, err := m.ApplyStimulus(r.Context(), stimulus)
+	if err != nil {
+		if errors.Is(err, nema.ErrInvalidStimulus) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// listWorms is a handler that returns every worm in the registry.
+func (s *Server) listWorms(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.worms.List()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -17,10 +17,10 @@ type Server struct {
 	log           *zap.Logger
 	publicRouter  *chi.Mux
 	privateRouter *chi.Mux
-	nemaManager   *nema.Manager
+	worms         *nema.Worms
 }
 
-func NewServer(log *zap.Logger, nemaManager *nema.Manager) *Server {
+func NewServer(log *zap.Logger, worms *nema.Worms) *Server {
 	setupRouter := func() *chi.Mux {
 		router := chi.NewRouter()
 		router.Use(middleware.Logger)
@@ -33,7 +33,7 @@ func NewServer(log *zap.Logger, nemaManager *nema.Manager) *Server {
 
 	s := &Server{
 		log:           log,
-		nemaManager:   nemaManager,
+		worms:         worms,
 		publicRouter:  publicRouter,
 		privateRouter: privateRouter,
 	}
@@ -44,18 +44,67 @@ func NewServer(log *zap.Logger, nemaManager *nema.Manager) *Server {
 		w.WriteHeader(http.StatusOK)
 	})
 	publicRouter.Get("/nema/state", s.nemaState)
+	publicRouter.Get("/nema/neurons", s.nemaNeurons)
+	publicRouter.Get("/nema/posture", s.nemaPosture)
+	publicRouter.Get("/nema/sleep", s.nemaSleep)
 	// publicRouter.Post("/nema/prompt", s.nemaPrompt)
 
+	// Every worm of the registry, including the public Nema with the ID "nema"
+	publicRouter.Get("/worms", s.listWorms)
+	publicRouter.Route("/worms/{id}", func(r chi.Router) {
+		r.Get("/state", s.nemaState)
+		r.Get("/neurons", s.nemaNeurons)
+		r.Get("/posture", s.nemaPosture)
+		r.Get("/sleep", s.nemaSleep)
+	})
+
 	// -------------------------------------------------------------------------
 	// Private routes (prefixed with /internal)
 	privateRouter.Route("/internal", func(r chi.Router) {
 		r.Post("/tweet", s.tweet)
 		r.Post("/tweet/reply", s.tweetReply)
+
+		// Stimuli change the state like prompts do, so they are private too
+		r.Post("/stimulus", s.nemaStimulus)
+
+		// Lesion experiments
+		r.Get("/lesions", s.lesions)
+		r.Post("/lesions", s.lesion)
+		r.Delete("/lesions", s.removeLesion)
+		r.Delete("/lesions/{target}", s.removeLesion)
+
+		r.Post("/worms", s.createWorm)
+		r.Route("/worms/{id}", func(r chi.Router) {
+			// Prompting stays private, like the commented out public
+			// /nema/prompt route
+			r.Post("/prompt", s.nemaPrompt)
+			r.Post("/stimulus", s.nemaStimulus)
+			r.Get("/lesions", s.lesions)
+			r.Post("/lesions", s.lesion)
+			r.Delete("/lesions", s.removeLesion)
+			r.Delete("/lesions/{target}", s.removeLesion)
+		})
 	})
 
 	return s
 }
 
+// manager returns the manager of the worm in the {id} route parameter, or of
+// the public Nema on routes without one. It writes a 404 and returns false for
+// unknown worms.
+func (s *Server) manager(w http.ResponseWriter, r *http.Request) (*nema.Manager, bool) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return s.worms.Default(), true
+	}
+	m, err := s.worms.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return m, true
+}
+
 // Start launches both the public and private servers
 func (s *Server) Start(ctx context.Context, publicPort, privatePort string) error {
 	errChan := make(chan error, 2)